@@ -60,6 +60,11 @@ type stateButton struct {
 	hook  UpdateHandler
 }
 
+// backButton is a button that switches to the previous state when clicked.
+type backButton struct {
+	baseButton
+}
+
 // rawButton is only a raw button that does nothing but sends the button name.
 type rawButton struct {
 	baseButton
@@ -253,6 +258,25 @@ func (b *ActionBuilder) AddStateButtonWithHook(
 	return b
 }
 
+func BackButton(button TextBuilder, opts ...*ButtonOptions) Action {
+	return backButton{
+		baseButton: baseButton{
+			button:  button,
+			options: opts,
+		},
+	}
+}
+
+// AddBackButton adds a button to the ActionBuilder that switches to the previous state.
+func (b *ActionBuilder) AddBackButton(button TextBuilder, opts ...*ButtonOptions) *ActionBuilder {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	b.buttons = append(b.buttons, BackButton(button, opts...))
+
+	return b
+}
+
 func RawButton(button TextBuilder, opts ...*ButtonOptions) Action {
 	return rawButton{
 		baseButton: baseButton{
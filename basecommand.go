@@ -1,5 +1,10 @@
 package telejoon
 
+import (
+	"strings"
+	"unicode"
+)
+
 type baseCommand struct {
 	command TextBuilder
 }
@@ -8,6 +13,67 @@ func (b baseCommand) Name(update *StateUpdate) string {
 	return b.command.String(update)
 }
 
+// staticName returns the name of the command if it doesn't depend on the update.
+func (b baseCommand) staticName() (string, bool) {
+	if name, ok := b.command.(StaticTextBuilder); ok {
+		return strings.TrimPrefix(string(name), "/"), true
+	}
+
+	return "", false
+}
+
+// parseCommand parses a "/name@bot args" text into its parts, the args are separated by any whitespace.
+func parseCommand(text string) (name, botName, args string, ok bool) {
+	if !strings.HasPrefix(text, "/") || len(text) < 2 {
+		return "", "", "", false
+	}
+
+	command, args := text[1:], ""
+	if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+		command, args = command[:i], command[i:]
+	}
+
+	name, botName, _ = strings.Cut(command, "@")
+
+	if name == "" {
+		return "", "", "", false
+	}
+
+	return name, botName, strings.TrimSpace(args), true
+}
+
+// staticCommandNames returns the names of the commands that don't depend on the update.
+func (b *ActionBuilder) staticCommandNames() []string {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	var names []string
+
+	for _, action := range b.commands {
+		if cmd, ok := action.(interface{ staticName() (string, bool) }); ok {
+			if name, ok := cmd.staticName(); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// getCommandByName returns the command action by its name, the leading slash of the command names is optional.
+func (b *ActionBuilder) getCommandByName(update *StateUpdate, name string) Action {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	for _, action := range b.commands {
+		if strings.TrimPrefix(action.Name(update), "/") == name {
+			return action
+		}
+	}
+
+	return nil
+}
+
 // textCommand is a command that sends a text message.
 type textCommand struct {
 	baseCommand
@@ -0,0 +1,67 @@
+package telejoon_test
+
+import (
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text    string
+		name    string
+		botName string
+		args    string
+		ok      bool
+	}{
+		{text: "/help", name: "help", ok: true},
+		{text: "/help@MyBot", name: "help", botName: "MyBot", ok: true},
+		{text: "/add 1 2", name: "add", args: "1 2", ok: true},
+		{text: "/add@MyBot  1 2 ", name: "add", botName: "MyBot", args: "1 2", ok: true},
+		{text: "/add\n1\n2", name: "add", args: "1\n2", ok: true},
+		{text: "/add\t@MyBot", name: "add", args: "@MyBot", ok: true},
+		{text: "/start ref_42", name: "start", args: "ref_42", ok: true},
+		{text: "/@MyBot"},
+		{text: "/"},
+		{text: "/ help"},
+		{text: "help"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			name, botName, args, ok := telejoon.ParseCommand(tt.text)
+
+			if name != tt.name || botName != tt.botName || args != tt.args || ok != tt.ok {
+				t.Fatalf("expected (%q, %q, %q, %v), got (%q, %q, %q, %v)",
+					tt.name, tt.botName, tt.args, tt.ok, name, botName, args, ok)
+			}
+		})
+	}
+}
+
+func TestStateUpdate_CommandArgs(t *testing.T) {
+	var command, args string
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		AddGlobalCommand("/add", func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+			telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			command, args = update.Command(), update.CommandArgs()
+
+			return nil, false
+		}).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	engine.Process(nil, tgbotapi.Update{Message: &structs.Message{
+		From: &structs.User{Id: 1},
+		Chat: &structs.Chat{Id: 1, Type: "private"},
+		Text: "/add@MyBot 1 2",
+	}})
+
+	if command != "add" || args != "1 2" {
+		t.Fatalf("expected the add command with 1 2, got %q with %q", command, args)
+	}
+}
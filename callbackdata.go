@@ -0,0 +1,365 @@
+package telejoon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxCallbackDataLength = 64
+
+	// storedCallbackDataPrefix marks the callback data that is swapped for an id by the store codec.
+	storedCallbackDataPrefix = "~"
+
+	// callbackDataSweepInterval is the number of saves between the sweeps of the expired callback data.
+	callbackDataSweepInterval = 100
+)
+
+var (
+	CallbackDataTooLongErr = errors.New("callback_data_too_long")
+	CallbackDataExpiredErr = errors.New("callback_data_expired")
+
+	InvalidCallbackMenuNameErr = errors.New("invalid_callback_menu_name")
+)
+
+// CallbackData is the decoded callback data of an inline button.
+type CallbackData struct {
+	Menu   string
+	Action string
+	Args   []string
+}
+
+func (c CallbackData) parts() []string {
+	if c.Action == "" && len(c.Args) == 0 {
+		return []string{c.Menu}
+	}
+
+	return append([]string{c.Menu, c.Action}, c.Args...)
+}
+
+// handlerArgs returns the args passed to the callback query handlers, the action followed by the args.
+func (c CallbackData) handlerArgs() []string {
+	return c.parts()[1:]
+}
+
+func callbackDataFromParts(parts []string) CallbackData {
+	data := CallbackData{
+		Menu: parts[0],
+	}
+
+	if len(parts) > 1 {
+		data.Action = parts[1]
+		data.Args = parts[2:]
+	}
+
+	return data
+}
+
+// CallbackDataCodec encodes the callback data of inline buttons and decodes the data of callback queries.
+type CallbackDataCodec interface {
+	Encode(ctx context.Context, data CallbackData) (string, error)
+	Decode(ctx context.Context, data string) (CallbackData, error)
+}
+
+// callbackMenuRegistrar is a CallbackDataCodec that needs to know the inline menus.
+type callbackMenuRegistrar interface {
+	registerMenu(name string) error
+}
+
+// registerCallbackMenu registers the inline menu if the codec needs to know the menus.
+func registerCallbackMenu(codec CallbackDataCodec, name string) error {
+	if registrar, ok := codec.(callbackMenuRegistrar); ok {
+		if err := registrar.registerMenu(name); err != nil {
+			return fmt.Errorf("error_registering_callback_menu: %s, %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// escapeCallbackPart escapes the separators in a part of the callback data.
+func escapeCallbackPart(part string) string {
+	return strings.NewReplacer(`\`, `\\`, ":", `\:`).Replace(part)
+}
+
+func joinCallbackData(parts []string) string {
+	escaped := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		escaped = append(escaped, escapeCallbackPart(part))
+	}
+
+	return strings.Join(escaped, ":")
+}
+
+// splitCallbackData splits the callback data on the unescaped separators and unescapes the parts.
+func splitCallbackData(data string) []string {
+	var (
+		parts   []string
+		current strings.Builder
+		escaped bool
+	)
+
+	for _, r := range data {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ':':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	return append(parts, current.String())
+}
+
+// NewCallbackDataText returns the data of an inline button with its args escaped, so they can contain any character.
+func NewCallbackDataText(action string, args ...TextBuilder) TextBuilder {
+	return NewDeferredText(func(update *StateUpdate) string {
+		parts := []string{action}
+
+		for _, arg := range args {
+			parts = append(parts, arg.String(update))
+		}
+
+		return joinCallbackData(parts)
+	})
+}
+
+type defaultCallbackDataCodec struct{}
+
+// NewDefaultCallbackDataCodec returns a CallbackDataCodec that encodes the data as "menu:action:args..." with the
+// separators escaped, it returns CallbackDataTooLongErr when the data is over the limit of Telegram.
+func NewDefaultCallbackDataCodec() CallbackDataCodec {
+	return defaultCallbackDataCodec{}
+}
+
+func (defaultCallbackDataCodec) Encode(_ context.Context, data CallbackData) (string, error) {
+	encoded := joinCallbackData(data.parts())
+	if len(encoded) > maxCallbackDataLength {
+		return "", fmt.Errorf("%w: %s", CallbackDataTooLongErr, encoded)
+	}
+
+	return encoded, nil
+}
+
+func (defaultCallbackDataCodec) Decode(_ context.Context, data string) (CallbackData, error) {
+	return callbackDataFromParts(splitCallbackData(data)), nil
+}
+
+type compactCallbackDataCodec struct {
+	lock sync.RWMutex
+
+	ids   map[string]string
+	menus map[string]string
+}
+
+// NewCompactCallbackDataCodec returns a CallbackDataCodec that replaces the names of the inline menus with a short
+// hash, the rest is encoded like the default codec. A menu whose hash collides with another menu gets a longer hash,
+// so the menus should be added in the same order by all the instances of the bot.
+func NewCompactCallbackDataCodec() CallbackDataCodec {
+	return &compactCallbackDataCodec{
+		ids:   map[string]string{},
+		menus: map[string]string{},
+	}
+}
+
+func (c *compactCallbackDataCodec) registerMenu(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.ids[name]; ok {
+		return nil
+	}
+
+	shortHash := fnv.New32a()
+	_, _ = shortHash.Write([]byte(name))
+
+	longHash := fnv.New64a()
+	_, _ = longHash.Write([]byte(name))
+
+	id := strconv.FormatUint(uint64(shortHash.Sum32()), 36)
+
+	// the collisions are broken with the longer hash, followed by a counter in the unlikely case it collides too
+	for n := 0; c.menus[id] != ""; n++ {
+		id = strconv.FormatUint(longHash.Sum64(), 36)
+		if n > 0 {
+			id += "." + strconv.Itoa(n)
+		}
+	}
+
+	c.ids[name] = id
+	c.menus[id] = name
+
+	return nil
+}
+
+func (c *compactCallbackDataCodec) Encode(ctx context.Context, data CallbackData) (string, error) {
+	c.lock.RLock()
+	if id, ok := c.ids[data.Menu]; ok {
+		data.Menu = id
+	}
+	c.lock.RUnlock()
+
+	return defaultCallbackDataCodec{}.Encode(ctx, data)
+}
+
+func (c *compactCallbackDataCodec) Decode(ctx context.Context, data string) (CallbackData, error) {
+	decoded, err := defaultCallbackDataCodec{}.Decode(ctx, data)
+	if err != nil {
+		return decoded, err
+	}
+
+	c.lock.RLock()
+	if menu, ok := c.menus[decoded.Menu]; ok {
+		decoded.Menu = menu
+	}
+	c.lock.RUnlock()
+
+	return decoded, nil
+}
+
+// CallbackDataStore stores the callback data swapped for short ids.
+type CallbackDataStore interface {
+	SaveCallbackData(ctx context.Context, id, data string, ttl time.Duration) error
+	// LoadCallbackData returns an empty string if the data isn't found or is expired.
+	LoadCallbackData(ctx context.Context, id string) (string, error)
+}
+
+type callbackDataEntry struct {
+	data      string
+	expiresAt time.Time
+}
+
+type defaultCallbackDataStore struct {
+	lock sync.Mutex
+
+	entries map[string]callbackDataEntry
+	saves   int
+}
+
+// NewDefaultCallbackDataStore Factory function for defaultCallbackDataStore.
+func NewDefaultCallbackDataStore() CallbackDataStore {
+	return &defaultCallbackDataStore{
+		entries: map[string]callbackDataEntry{},
+	}
+}
+
+func (s *defaultCallbackDataStore) SaveCallbackData(_ context.Context, id, data string, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+
+	s.saves++
+	if s.saves%callbackDataSweepInterval == 0 {
+		for key, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+	}
+
+	s.entries[id] = callbackDataEntry{
+		data:      data,
+		expiresAt: now.Add(ttl),
+	}
+
+	return nil
+}
+
+func (s *defaultCallbackDataStore) LoadCallbackData(_ context.Context, id string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", nil
+	}
+
+	return entry.data, nil
+}
+
+type storeCallbackDataCodec struct {
+	codec CallbackDataCodec
+	store CallbackDataStore
+	ttl   time.Duration
+}
+
+// NewStoreCallbackDataCodec returns a CallbackDataCodec that encodes the data using codec, and swaps the data that is
+// over the limit of Telegram for a short id kept in the store for ttl. The decoding of expired ids returns
+// CallbackDataExpiredErr. The inline menus whose data would start with "~" are rejected, e.g. the menus named "~..."
+// when codec doesn't replace the names like the compact codec does.
+func NewStoreCallbackDataCodec(codec CallbackDataCodec, store CallbackDataStore, ttl time.Duration) CallbackDataCodec {
+	return storeCallbackDataCodec{
+		codec: codec,
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+func (s storeCallbackDataCodec) registerMenu(name string) error {
+	if registrar, ok := s.codec.(callbackMenuRegistrar); ok {
+		if err := registrar.registerMenu(name); err != nil {
+			return err
+		}
+	}
+
+	// the data of the menu would be taken for a stored id
+	encoded, err := s.codec.Encode(context.Background(), CallbackData{Menu: name})
+	if err == nil && strings.HasPrefix(encoded, storedCallbackDataPrefix) {
+		return fmt.Errorf("%w: %s", InvalidCallbackMenuNameErr, name)
+	}
+
+	return nil
+}
+
+func (s storeCallbackDataCodec) Encode(ctx context.Context, data CallbackData) (string, error) {
+	encoded, err := s.codec.Encode(ctx, data)
+	if !errors.Is(err, CallbackDataTooLongErr) {
+		return encoded, err
+	}
+
+	id := make([]byte, 9)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error_generating_callback_data_id: %w", err)
+	}
+
+	key := base64.RawURLEncoding.EncodeToString(id)
+
+	if err := s.store.SaveCallbackData(ctx, key, joinCallbackData(data.parts()), s.ttl); err != nil {
+		return "", fmt.Errorf("error_saving_callback_data: %w", err)
+	}
+
+	return storedCallbackDataPrefix + key, nil
+}
+
+func (s storeCallbackDataCodec) Decode(ctx context.Context, data string) (CallbackData, error) {
+	if !strings.HasPrefix(data, storedCallbackDataPrefix) {
+		return s.codec.Decode(ctx, data)
+	}
+
+	stored, err := s.store.LoadCallbackData(ctx, strings.TrimPrefix(data, storedCallbackDataPrefix))
+	if err != nil {
+		return CallbackData{}, fmt.Errorf("error_loading_callback_data: %w", err)
+	}
+
+	if stored == "" {
+		return CallbackData{}, fmt.Errorf("%w: %s", CallbackDataExpiredErr, data)
+	}
+
+	return callbackDataFromParts(splitCallbackData(stored)), nil
+}
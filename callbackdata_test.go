@@ -0,0 +1,218 @@
+package telejoon_test
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestCallbackDataCodecs(t *testing.T) {
+	ctx := context.Background()
+
+	data := telejoon.CallbackData{
+		Menu:   "Orders",
+		Action: "open",
+		Args:   []string{`12:30`, `a\b`},
+	}
+
+	long := telejoon.CallbackData{
+		Menu:   "Orders",
+		Action: "search",
+		Args:   []string{strings.Repeat("x", 80)},
+	}
+
+	if _, err := telejoon.NewDefaultCallbackDataCodec().Encode(ctx, long); !errors.Is(err, telejoon.CallbackDataTooLongErr) {
+		t.Fatalf("expected CallbackDataTooLongErr, got %v", err)
+	}
+
+	codecs := map[string]telejoon.CallbackDataCodec{
+		"default": telejoon.NewDefaultCallbackDataCodec(),
+		"compact": telejoon.NewCompactCallbackDataCodec(),
+		"store": telejoon.NewStoreCallbackDataCodec(
+			telejoon.NewDefaultCallbackDataCodec(), telejoon.NewDefaultCallbackDataStore(), time.Minute),
+	}
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			for _, d := range []telejoon.CallbackData{data, long} {
+				if name != "store" && len(d.Args[0]) > 64 {
+					continue
+				}
+
+				encoded, err := codec.Encode(ctx, d)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(encoded) > 64 {
+					t.Fatalf("expected at most 64 bytes, got %d", len(encoded))
+				}
+
+				decoded, err := codec.Decode(ctx, encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(decoded, d) {
+					t.Fatalf("expected %+v, got %+v", d, decoded)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreCallbackDataCodec_Expired(t *testing.T) {
+	ctx := context.Background()
+
+	codec := telejoon.NewStoreCallbackDataCodec(
+		telejoon.NewDefaultCallbackDataCodec(), telejoon.NewDefaultCallbackDataStore(), time.Millisecond)
+
+	encoded, err := codec.Encode(ctx, telejoon.CallbackData{Menu: "Orders", Action: strings.Repeat("x", 80)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := codec.Decode(ctx, encoded); !errors.Is(err, telejoon.CallbackDataExpiredErr) {
+		t.Fatalf("expected CallbackDataExpiredErr, got %v", err)
+	}
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestSignedCallbackDataCodec(t *testing.T) {
+	ctx := context.Background()
+
+	clock := &fixedClock{now: time.Unix(1700000000, 0)}
+
+	codec := telejoon.NewSignedCallbackDataCodec(
+		telejoon.NewDefaultCallbackDataCodec(), []byte("secret"), time.Hour).WithClock(clock)
+
+	data := telejoon.CallbackData{Menu: "Orders", Action: "delete", Args: []string{"42"}}
+
+	encoded, err := codec.Encode(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := codec.Decode(ctx, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, data) {
+		t.Fatalf("expected %+v, got %+v", data, decoded)
+	}
+
+	forged := strings.Replace(encoded, "42", "43", 1)
+
+	if _, err := codec.Decode(ctx, forged); !errors.Is(err, telejoon.CallbackDataInvalidSignatureErr) {
+		t.Fatalf("expected CallbackDataInvalidSignatureErr, got %v", err)
+	}
+
+	if _, err := codec.Decode(ctx, "Orders:delete:42"); !errors.Is(err, telejoon.CallbackDataInvalidSignatureErr) {
+		t.Fatalf("expected CallbackDataInvalidSignatureErr for unsigned data, got %v", err)
+	}
+
+	clock.now = clock.now.Add(2 * time.Hour)
+
+	if _, err := codec.Decode(ctx, encoded); !errors.Is(err, telejoon.CallbackDataExpiredErr) {
+		t.Fatalf("expected CallbackDataExpiredErr, got %v", err)
+	}
+}
+
+func TestCompactCallbackDataCodec_Collision(t *testing.T) {
+	ctx := context.Background()
+
+	// find two menu names with the same short hash
+	var first, second string
+
+	seen := map[uint32]string{}
+
+	for i := 0; second == ""; i++ {
+		name := "Menu" + strconv.Itoa(i)
+
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(name))
+
+		if other, ok := seen[hash.Sum32()]; ok {
+			first, second = other, name
+		}
+
+		seen[hash.Sum32()] = name
+	}
+
+	codec := telejoon.NewCompactCallbackDataCodec()
+
+	telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithCallbackDataCodec(codec).
+		AddInlineMenu(first, telejoon.NewInlineMenu(telejoon.NewStaticText(first), nil)).
+		AddInlineMenu(second, telejoon.NewInlineMenu(telejoon.NewStaticText(second), nil))
+
+	encoded := map[string]string{}
+
+	for _, menu := range []string{first, second} {
+		data, err := codec.Encode(ctx, telejoon.CallbackData{Menu: menu, Action: "open"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := codec.Decode(ctx, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if decoded.Menu != menu {
+			t.Fatalf("expected %s to round trip, got %s", menu, decoded.Menu)
+		}
+
+		encoded[menu] = data
+	}
+
+	// the menus added before the codec is set are registered in the order they're added
+	for i := 0; i < 20; i++ {
+		codec := telejoon.NewCompactCallbackDataCodec()
+
+		telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+			AddInlineMenu(first, telejoon.NewInlineMenu(telejoon.NewStaticText(first), nil)).
+			AddInlineMenu(second, telejoon.NewInlineMenu(telejoon.NewStaticText(second), nil)).
+			WithCallbackDataCodec(codec)
+
+		for _, menu := range []string{first, second} {
+			data, err := codec.Encode(ctx, telejoon.CallbackData{Menu: menu, Action: "open"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if data != encoded[menu] {
+				t.Fatalf("expected %s to be encoded as %s, got %s", menu, encoded[menu], data)
+			}
+		}
+	}
+}
+
+func TestStoreCallbackDataCodec_RejectsStoredPrefix(t *testing.T) {
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithCallbackDataCodec(telejoon.NewStoreCallbackDataCodec(
+			telejoon.NewDefaultCallbackDataCodec(), telejoon.NewDefaultCallbackDataStore(), time.Minute)).
+		AddInlineMenu("~Menu", telejoon.NewInlineMenu(telejoon.NewStaticText("Menu"), nil))
+
+	err := engine.SendInlineMenu(nil, &telejoon.StateUpdate{}, "~Menu", false)
+	if !errors.Is(err, telejoon.InvalidCallbackMenuNameErr) {
+		t.Fatalf("expected InvalidCallbackMenuNameErr, got %v", err)
+	}
+}
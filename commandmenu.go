@@ -0,0 +1,194 @@
+package telejoon
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+type CommandScope string
+
+const (
+	CommandScopeDefault               CommandScope = "default"
+	CommandScopeAllPrivateChats       CommandScope = "all_private_chats"
+	CommandScopeAllGroupChats         CommandScope = "all_group_chats"
+	CommandScopeAllChatAdministrators CommandScope = "all_chat_administrators"
+)
+
+// MarshalJSON encodes the scope as a BotCommandScope object.
+func (s CommandScope) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"type": string(s)})
+}
+
+var commandNameRegex = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// BotCommand is a command and its description as shown in the Telegram command menu.
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// CommandMenuPayload is the payload of a setMyCommands call.
+type CommandMenuPayload struct {
+	Scope        CommandScope `json:"scope"`
+	LanguageCode string       `json:"language_code,omitempty"`
+	Commands     []BotCommand `json:"commands"`
+}
+
+type CommandMenuPublisher func(payload CommandMenuPayload) error
+
+type commandMenuScope struct {
+	scope    CommandScope
+	commands []string
+}
+
+// CommandMenuSync publishes the commands of each scope using setMyCommands, once without a language code using the
+// default descriptions and once for each language of the LanguageConfig.
+// The description of a command is read from the "Commands.<command>" key of the language.
+type CommandMenuSync struct {
+	lock sync.Mutex
+
+	languageConfig *LanguageConfig
+
+	scopes []commandMenuScope
+
+	descriptions map[string]string
+}
+
+// NewCommandMenuSync creates a new CommandMenuSync, languageConfig can be nil.
+func NewCommandMenuSync(languageConfig *LanguageConfig) *CommandMenuSync {
+	return &CommandMenuSync{
+		languageConfig: languageConfig,
+		descriptions:   map[string]string{},
+	}
+}
+
+// AddScope adds the commands of a scope, e.g. AddScope(CommandScopeAllPrivateChats, engine.CommandNames()...).
+func (c *CommandMenuSync) AddScope(scope CommandScope, commands ...string) *CommandMenuSync {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.scopes = append(c.scopes, commandMenuScope{
+		scope:    scope,
+		commands: commands,
+	})
+
+	return c
+}
+
+// SetDescription sets the default description of a command, used when the language doesn't have one.
+func (c *CommandMenuSync) SetDescription(command, description string) *CommandMenuSync {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.descriptions[command] = description
+
+	return c
+}
+
+// Payloads returns the setMyCommands payloads without publishing them.
+func (c *CommandMenuSync) Payloads() ([]CommandMenuPayload, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var languages []*Language
+
+	if c.languageConfig != nil {
+		for i := range c.languageConfig.languages.localizers {
+			languages = append(languages, &c.languageConfig.languages.localizers[i])
+		}
+	}
+
+	var payloads []CommandMenuPayload
+
+	for _, scope := range c.scopes {
+		for _, command := range scope.commands {
+			if !commandNameRegex.MatchString(command) {
+				return nil, fmt.Errorf("invalid_command_name: %s", command)
+			}
+		}
+
+		payloads = append(payloads, CommandMenuPayload{
+			Scope:    scope.scope,
+			Commands: c.botCommands(scope.commands, nil),
+		})
+
+		for _, lang := range languages {
+			payloads = append(payloads, CommandMenuPayload{
+				Scope:        scope.scope,
+				LanguageCode: lang.tag,
+				Commands:     c.botCommands(scope.commands, lang),
+			})
+		}
+	}
+
+	return payloads, nil
+}
+
+// Sync publishes the payloads using the publisher.
+func (c *CommandMenuSync) Sync(publisher CommandMenuPublisher) error {
+	payloads, err := c.Payloads()
+	if err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		if err := publisher(payload); err != nil {
+			return fmt.Errorf("error_publishing_commands: %s %s, %w", payload.Scope, payload.LanguageCode, err)
+		}
+	}
+
+	return nil
+}
+
+// NewClientCommandMenuPublisher returns a CommandMenuPublisher that calls setMyCommands using the client.
+func NewClientCommandMenuPublisher(client *tgbotapi.TelegramBot) CommandMenuPublisher {
+	return func(payload CommandMenuPayload) error {
+		commands := make([]structs.BotCommand, 0, len(payload.Commands))
+
+		for _, command := range payload.Commands {
+			commands = append(commands, structs.BotCommand{
+				Command:     command.Command,
+				Description: command.Description,
+			})
+		}
+
+		_, err := client.Send(client.SetMyCommands().
+			SetCommands(commands).
+			SetScope(map[string]string{"type": string(payload.Scope)}).
+			SetLanguageCode(payload.LanguageCode))
+
+		return err
+	}
+}
+
+func (c *CommandMenuSync) botCommands(commands []string, lang *Language) []BotCommand {
+	result := make([]BotCommand, 0, len(commands))
+
+	for _, command := range commands {
+		description := ""
+
+		if lang != nil {
+			description, _ = lang.Get(fmt.Sprintf("Commands.%s", command))
+		}
+
+		if description == "" {
+			description = c.descriptions[command]
+		}
+
+		if description == "" {
+			description = command
+		}
+
+		result = append(result, BotCommand{
+			Command:     command,
+			Description: description,
+		})
+	}
+
+	return result
+}
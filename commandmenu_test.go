@@ -0,0 +1,118 @@
+package telejoon_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aliforever/go-telejoon"
+	"golang.org/x/text/language"
+)
+
+func TestCommandMenuSync_Payloads(t *testing.T) {
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Welcome").
+		AddGlobalStateCommand("/start", "Welcome").
+		AddStaticMenu("Welcome", telejoon.NewStaticMenu(
+			telejoon.NewStaticText("Welcome"),
+			telejoon.NewStaticActionBuilder().
+				AddStateCommand(telejoon.NewStaticText("/help"), "Help")))
+
+	payloads, err := telejoon.NewCommandMenuSync(nil).
+		AddScope(telejoon.CommandScopeAllPrivateChats, engine.CommandNames()...).
+		SetDescription("start", "Start the bot").
+		Payloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []telejoon.CommandMenuPayload{
+		{
+			Scope: telejoon.CommandScopeAllPrivateChats,
+			Commands: []telejoon.BotCommand{
+				{Command: "help", Description: "help"},
+				{Command: "start", Description: "Start the bot"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(payloads, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, payloads)
+	}
+
+	var published []telejoon.CommandMenuPayload
+
+	err = telejoon.NewCommandMenuSync(nil).
+		AddScope(telejoon.CommandScopeAllGroupChats, "Invalid-Command").
+		Sync(func(payload telejoon.CommandMenuPayload) error {
+			published = append(published, payload)
+			return nil
+		})
+	if err == nil || len(published) != 0 {
+		t.Fatalf("expected invalid command error without publishing, got %v and %v", err, published)
+	}
+}
+
+func TestCommandMenuSync_LanguagePayloads(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"en.toml": "[Commands]\nstart = \"Start the bot\"\nhelp = \"Show the help\"\n",
+		"fa.toml": "[Commands]\nstart = \"شروع ربات\"\n",
+	}
+
+	var paths []string
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	languages, err := telejoon.NewLanguageBuilder(language.English).RegisterTomlFormat(paths).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads, err := telejoon.NewCommandMenuSync(telejoon.NewLanguageConfig(languages, nil)).
+		AddScope(telejoon.CommandScopeDefault, "help", "start").
+		SetDescription("help", "Help").
+		Payloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]telejoon.BotCommand{
+		"": {
+			{Command: "help", Description: "Help"},
+			{Command: "start", Description: "start"},
+		},
+		"en": {
+			{Command: "help", Description: "Show the help"},
+			{Command: "start", Description: "Start the bot"},
+		},
+		// the missing description falls back to the default language of the bundle
+		"fa": {
+			{Command: "help", Description: "Show the help"},
+			{Command: "start", Description: "شروع ربات"},
+		},
+	}
+
+	if len(payloads) != len(expected) {
+		t.Fatalf("expected %d payloads, got %+v", len(expected), payloads)
+	}
+
+	for _, payload := range payloads {
+		if payload.Scope != telejoon.CommandScopeDefault {
+			t.Fatalf("expected the default scope, got %s", payload.Scope)
+		}
+
+		if !reflect.DeepEqual(payload.Commands, expected[payload.LanguageCode]) {
+			t.Fatalf("expected %+v for %q, got %+v",
+				expected[payload.LanguageCode], payload.LanguageCode, payload.Commands)
+		}
+	}
+}
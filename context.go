@@ -0,0 +1,52 @@
+package telejoon
+
+import (
+	"context"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+// ContextProcessor is a Processor that receives the context of the update.
+type ContextProcessor interface {
+	Processor
+	ProcessContext(ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update)
+}
+
+type ContextUpdateHandler func(
+	ctx context.Context,
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+) (SwitchAction, ShouldPass)
+
+// NewContextUpdateHandler adapts a ContextUpdateHandler to an UpdateHandler.
+func NewContextUpdateHandler(handler ContextUpdateHandler) UpdateHandler {
+	return func(client *tgbotapi.TelegramBot, update *StateUpdate) (SwitchAction, ShouldPass) {
+		return handler(update.Context(), client, update)
+	}
+}
+
+type ContextCallbackHandler func(
+	ctx context.Context,
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	args ...string,
+) (SwitchAction, error)
+
+// NewContextCallbackHandler adapts a ContextCallbackHandler to a CallbackHandler.
+func NewContextCallbackHandler(handler ContextCallbackHandler) CallbackHandler {
+	return func(client *tgbotapi.TelegramBot, update *StateUpdate, args ...string) (SwitchAction, error) {
+		return handler(update.Context(), client, update, args...)
+	}
+}
+
+// ContextTextBuilder is a TextBuilder that receives the context of the update.
+type ContextTextBuilder func(ctx context.Context, update *StateUpdate) string
+
+func (t ContextTextBuilder) String(update *StateUpdate) string {
+	return t(update.Context(), update)
+}
+
+// NewContextText returns a new ContextTextBuilder
+func NewContextText(text func(ctx context.Context, update *StateUpdate) string) ContextTextBuilder {
+	return text
+}
@@ -0,0 +1,106 @@
+package telejoon
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+type deepLink struct {
+	prefix string
+	regex  *regexp.Regexp
+
+	handler UpdateHandler
+}
+
+// match returns the matches of the payload, the prefix routes return the payload and the rest after the prefix.
+func (d deepLink) match(payload string) []string {
+	if d.regex != nil {
+		return d.regex.FindStringSubmatch(payload)
+	}
+
+	if strings.HasPrefix(payload, d.prefix) {
+		return []string{payload, strings.TrimPrefix(payload, d.prefix)}
+	}
+
+	return nil
+}
+
+// DeepLinks routes the payloads of "t.me/bot?start=<payload>" links, routes are checked in the order they're added.
+type DeepLinks struct {
+	lock sync.Mutex
+
+	links []deepLink
+}
+
+// NewDeepLinks creates a new DeepLinks.
+func NewDeepLinks() *DeepLinks {
+	return &DeepLinks{}
+}
+
+func (d *DeepLinks) add(link deepLink) *DeepLinks {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.links = append(d.links, link)
+
+	return d
+}
+
+// AddPrefixHandler adds a handler for the payloads starting with prefix.
+func (d *DeepLinks) AddPrefixHandler(prefix string, handler UpdateHandler) *DeepLinks {
+	return d.add(deepLink{prefix: prefix, handler: handler})
+}
+
+// AddPrefixState switches to the state for the payloads starting with prefix.
+func (d *DeepLinks) AddPrefixState(prefix string, state string) *DeepLinks {
+	return d.add(deepLink{prefix: prefix, handler: deepLinkSwitchHandler(NewSwitchActionState(state))})
+}
+
+// AddPrefixInlineMenu sends the inline menu for the payloads starting with prefix.
+func (d *DeepLinks) AddPrefixInlineMenu(prefix string, inlineMenu string) *DeepLinks {
+	return d.add(deepLink{
+		prefix:  prefix,
+		handler: deepLinkSwitchHandler(NewSwitchActionInlineMenu(inlineMenu, false)),
+	})
+}
+
+// AddRegexHandler adds a handler for the payloads matching the regex.
+func (d *DeepLinks) AddRegexHandler(regex *regexp.Regexp, handler UpdateHandler) *DeepLinks {
+	return d.add(deepLink{regex: regex, handler: handler})
+}
+
+// AddRegexState switches to the state for the payloads matching the regex.
+func (d *DeepLinks) AddRegexState(regex *regexp.Regexp, state string) *DeepLinks {
+	return d.add(deepLink{regex: regex, handler: deepLinkSwitchHandler(NewSwitchActionState(state))})
+}
+
+// AddRegexInlineMenu sends the inline menu for the payloads matching the regex.
+func (d *DeepLinks) AddRegexInlineMenu(regex *regexp.Regexp, inlineMenu string) *DeepLinks {
+	return d.add(deepLink{
+		regex:   regex,
+		handler: deepLinkSwitchHandler(NewSwitchActionInlineMenu(inlineMenu, false)),
+	})
+}
+
+// getHandler returns the handler of the first route matching the payload and the matches.
+func (d *DeepLinks) getHandler(payload string) (UpdateHandler, []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, link := range d.links {
+		if matches := link.match(payload); matches != nil {
+			return link.handler, matches
+		}
+	}
+
+	return nil, nil
+}
+
+func deepLinkSwitchHandler(action SwitchAction) UpdateHandler {
+	return func(*tgbotapi.TelegramBot, *StateUpdate) (SwitchAction, ShouldPass) {
+		return action, false
+	}
+}
@@ -0,0 +1,98 @@
+package telejoon_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestDeepLinks(t *testing.T) {
+	var (
+		payload string
+		matches []string
+	)
+
+	record := func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+		telejoon.SwitchAction, telejoon.ShouldPass) {
+
+		payload, matches = update.StartPayload(), update.StartPayloadMatches()
+
+		return nil, false
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		payload  string
+		matches  []string
+		newState string
+	}{
+		{
+			name:     "prefix handler",
+			text:     "/start ref_42",
+			payload:  "ref_42",
+			matches:  []string{"ref_42", "42"},
+			newState: "Home",
+		},
+		{
+			name:     "regex handler",
+			text:     "/start campaign-spring-7",
+			payload:  "campaign-spring-7",
+			matches:  []string{"campaign-spring-7", "spring", "7"},
+			newState: "Home",
+		},
+		{
+			name:     "routes in the order they're added",
+			text:     "/start ref_promo",
+			newState: "Promo",
+		},
+		{
+			name:     "prefix state",
+			text:     "/start promo",
+			newState: "Promo",
+		},
+		{
+			name:     "unmatched payload reaches the start command",
+			text:     "/start other",
+			newState: "Welcome",
+		},
+		{
+			name:     "start without a payload",
+			text:     "/start",
+			newState: "Welcome",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, matches = "", nil
+
+			repo := telejoon.NewDefaultUserRepository()
+
+			// the menus have no text, so nothing is sent to the chat
+			engine := telejoon.WithPrivateStateHandlers(repo, "Home").
+				WithDeepLinks(telejoon.NewDeepLinks().
+					AddRegexState(regexp.MustCompile(`^ref_promo$`), "Promo").
+					AddPrefixHandler("ref_", record).
+					AddRegexHandler(regexp.MustCompile(`^campaign-(\w+)-(\d+)$`), record).
+					AddPrefixState("promo", "Promo")).
+				AddGlobalStateCommand("/start", "Welcome").
+				AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+				AddStaticMenu("Welcome", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+				AddStaticMenu("Promo", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+			engine.Process(nil, privateTextUpdate(tt.text))
+
+			if payload != tt.payload || !reflect.DeepEqual(matches, tt.matches) {
+				t.Fatalf("expected the payload %q with %v, got %q with %v", tt.payload, tt.matches, payload, matches)
+			}
+
+			if state, _ := repo.GetUserState(1); state != tt.newState {
+				t.Fatalf("expected the state %s, got %s", tt.newState, state)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package telejoon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+// DispatchKey returns the key that updates are ordered by, updates without a key are processed concurrently.
+type DispatchKey func(update tgbotapi.Update) (int64, bool)
+
+// DispatchByUser orders the updates of each user.
+func DispatchByUser(update tgbotapi.Update) (int64, bool) {
+	if from := update.From(); from != nil {
+		return from.Id, true
+	}
+
+	return 0, false
+}
+
+// DispatchByChat orders the updates of each chat.
+func DispatchByChat(update tgbotapi.Update) (int64, bool) {
+	if chat := update.Chat(); chat != nil {
+		return chat.Id, true
+	}
+
+	return 0, false
+}
+
+var DrainTimeoutErr = errors.New("drain_timeout")
+
+const (
+	defaultDispatcherQueueSize = 100
+	defaultDrainTimeout        = 30 * time.Second
+)
+
+type dispatchedUpdate struct {
+	ctx    context.Context
+	update tgbotapi.Update
+}
+
+type dispatchQueue struct {
+	updates chan dispatchedUpdate
+	pending int
+}
+
+// Dispatcher passes updates to a Processor in order for each key, using one worker per active key.
+// A global concurrency limit can be set, and Dispatch blocks when the queue of a key is full.
+type Dispatcher struct {
+	processor Processor
+
+	lock sync.Mutex
+
+	key          DispatchKey
+	queueSize    int
+	drainTimeout time.Duration
+
+	semaphore chan struct{}
+
+	queues map[int64]*dispatchQueue
+
+	inFlight sync.WaitGroup
+}
+
+// NewDispatcher creates a new Dispatcher ordering updates by user.
+func NewDispatcher(processor Processor) *Dispatcher {
+	return &Dispatcher{
+		processor:    processor,
+		key:          DispatchByUser,
+		queueSize:    defaultDispatcherQueueSize,
+		drainTimeout: defaultDrainTimeout,
+		queues:       map[int64]*dispatchQueue{},
+	}
+}
+
+// WithKey sets the key that updates are ordered by.
+func (d *Dispatcher) WithKey(key DispatchKey) *Dispatcher {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.key = key
+
+	return d
+}
+
+// WithQueueSize sets the number of updates that can wait for each key before Dispatch blocks, negative sizes are
+// ignored.
+func (d *Dispatcher) WithQueueSize(size int) *Dispatcher {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if size >= 0 {
+		d.queueSize = size
+	}
+
+	return d
+}
+
+// WithMaxConcurrency sets the maximum number of updates processed at the same time, 0 means no limit.
+func (d *Dispatcher) WithMaxConcurrency(max int) *Dispatcher {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.semaphore = nil
+
+	if max > 0 {
+		d.semaphore = make(chan struct{}, max)
+	}
+
+	return d
+}
+
+// WithDrainTimeout sets how long Run waits for the in-flight updates after it stops, 0 means no limit.
+func (d *Dispatcher) WithDrainTimeout(timeout time.Duration) *Dispatcher {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.drainTimeout = timeout
+
+	return d
+}
+
+// Start dispatches the updates of the client until the updates channel is closed.
+func (d *Dispatcher) Start(client *tgbotapi.TelegramBot) {
+	for update := range client.Updates() {
+		d.Dispatch(client, update)
+	}
+}
+
+// Run dispatches the updates of the client until ctx is done or the updates channel is closed.
+// It then waits for the in-flight updates up to the drain timeout and returns DrainTimeoutErr if they didn't finish.
+func (d *Dispatcher) Run(ctx context.Context, client *tgbotapi.TelegramBot) error {
+	return d.RunUpdates(ctx, client, client.Updates())
+}
+
+// RunUpdates is like Run but takes the updates from the given channel, e.g. updates received by a webhook.
+func (d *Dispatcher) RunUpdates(
+	ctx context.Context, client *tgbotapi.TelegramBot, updates <-chan tgbotapi.Update) error {
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case update, ok := <-updates:
+			if !ok {
+				break loop
+			}
+
+			d.dispatch(ctx, client, update)
+		}
+	}
+
+	d.lock.Lock()
+	timeout := d.drainTimeout
+	d.lock.Unlock()
+
+	drainCtx := context.Background()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		drainCtx, cancel = context.WithTimeout(drainCtx, timeout)
+		defer cancel()
+	}
+
+	return d.Shutdown(drainCtx)
+}
+
+// Shutdown waits for the in-flight updates until ctx is done.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s", DrainTimeoutErr, ctx.Err())
+	}
+}
+
+// Dispatch queues the update if the processor can process it.
+func (d *Dispatcher) Dispatch(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	d.dispatch(context.Background(), client, update)
+}
+
+// dispatch queues the update, the update is dropped if ctx is done while waiting for the queue.
+// The processor receives ctx without its cancellation so in-flight updates can finish.
+func (d *Dispatcher) dispatch(ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	if !d.processor.CanProcess(update) {
+		return
+	}
+
+	item := dispatchedUpdate{
+		ctx:    context.WithoutCancel(ctx),
+		update: update,
+	}
+
+	d.inFlight.Add(1)
+
+	d.lock.Lock()
+
+	key, ok := d.key(update)
+	if !ok {
+		d.lock.Unlock()
+
+		go func() {
+			defer d.inFlight.Done()
+
+			d.process(client, item)
+		}()
+
+		return
+	}
+
+	queue := d.queues[key]
+	if queue == nil {
+		queue = &dispatchQueue{
+			updates: make(chan dispatchedUpdate, d.queueSize),
+		}
+
+		d.queues[key] = queue
+
+		go d.work(client, key, queue)
+	}
+
+	queue.pending++
+
+	d.lock.Unlock()
+
+	select {
+	case queue.updates <- item:
+	case <-ctx.Done():
+		d.inFlight.Done()
+
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		// the worker is idle once nothing is pending, so it's safe to stop it
+		queue.pending--
+		if queue.pending == 0 {
+			delete(d.queues, key)
+			close(queue.updates)
+		}
+	}
+}
+
+// Wait waits for the dispatched updates to be processed.
+func (d *Dispatcher) Wait() {
+	d.inFlight.Wait()
+}
+
+// work processes the updates of a key in order and stops once the queue is drained.
+func (d *Dispatcher) work(client *tgbotapi.TelegramBot, key int64, queue *dispatchQueue) {
+	for item := range queue.updates {
+		d.process(client, item)
+
+		d.inFlight.Done()
+
+		d.lock.Lock()
+
+		queue.pending--
+		if queue.pending == 0 {
+			delete(d.queues, key)
+			d.lock.Unlock()
+
+			return
+		}
+
+		d.lock.Unlock()
+	}
+}
+
+func (d *Dispatcher) process(client *tgbotapi.TelegramBot, item dispatchedUpdate) {
+	d.lock.Lock()
+	semaphore := d.semaphore
+	d.lock.Unlock()
+
+	if semaphore != nil {
+		semaphore <- struct{}{}
+		defer func() { <-semaphore }()
+	}
+
+	if processor, ok := d.processor.(ContextProcessor); ok {
+		processor.ProcessContext(item.ctx, client, item.update)
+		return
+	}
+
+	d.processor.Process(client, item.update)
+}
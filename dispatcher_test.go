@@ -0,0 +1,185 @@
+package telejoon_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestDispatcher_OrdersUpdatesPerKey(t *testing.T) {
+	var (
+		lock      sync.Mutex
+		processed []string
+	)
+
+	processor := telejoon.NewProcessorFunc(
+		func(update tgbotapi.Update) bool {
+			return true
+		},
+		func(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+			// the first update is the slowest, a racing update would overtake it
+			if update.Message.Text == "0" {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			lock.Lock()
+			processed = append(processed, update.Message.Text)
+			lock.Unlock()
+		},
+	)
+
+	dispatcher := telejoon.NewDispatcher(processor).
+		WithKey(func(update tgbotapi.Update) (int64, bool) {
+			return 1, true
+		}).
+		WithQueueSize(1)
+
+	for i := 0; i < 5; i++ {
+		dispatcher.Dispatch(nil, tgbotapi.Update{Message: &structs.Message{Text: strconv.Itoa(i)}})
+	}
+
+	dispatcher.Wait()
+
+	if len(processed) != 5 {
+		t.Fatalf("expected 5 processed updates, got %d", len(processed))
+	}
+
+	for i, text := range processed {
+		if text != strconv.Itoa(i) {
+			t.Fatalf("expected updates in order, got %v", processed)
+		}
+	}
+}
+
+func TestDispatcher_MaxConcurrency(t *testing.T) {
+	var running, maxRunning int64
+
+	processor := telejoon.NewProcessorFunc(
+		func(update tgbotapi.Update) bool {
+			return true
+		},
+		func(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+			current := atomic.AddInt64(&running, 1)
+			defer atomic.AddInt64(&running, -1)
+
+			for {
+				max := atomic.LoadInt64(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt64(&maxRunning, max, current) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		},
+	)
+
+	var key int64
+
+	dispatcher := telejoon.NewDispatcher(processor).
+		WithKey(func(update tgbotapi.Update) (int64, bool) {
+			return atomic.AddInt64(&key, 1), true
+		}).
+		WithMaxConcurrency(2)
+
+	for i := 0; i < 10; i++ {
+		dispatcher.Dispatch(nil, tgbotapi.Update{})
+	}
+
+	dispatcher.Wait()
+
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 concurrent updates, got %d", maxRunning)
+	}
+}
+
+func TestDispatcher_Shutdown(t *testing.T) {
+	release := make(chan struct{})
+
+	processor := telejoon.NewProcessorFunc(
+		func(update tgbotapi.Update) bool {
+			return true
+		},
+		func(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+			<-release
+		},
+	)
+
+	dispatcher := telejoon.NewDispatcher(processor).
+		WithKey(func(update tgbotapi.Update) (int64, bool) {
+			return 1, true
+		})
+
+	dispatcher.Dispatch(nil, tgbotapi.Update{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := dispatcher.Shutdown(ctx); !errors.Is(err, telejoon.DrainTimeoutErr) {
+		t.Fatalf("expected DrainTimeoutErr, got %v", err)
+	}
+
+	close(release)
+
+	if err := dispatcher.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error after the update is processed, got %v", err)
+	}
+}
+
+func TestDispatcher_RunUpdatesDrainsInOrder(t *testing.T) {
+	var (
+		lock      sync.Mutex
+		processed []string
+	)
+
+	processor := telejoon.NewProcessorFunc(
+		func(update tgbotapi.Update) bool {
+			return true
+		},
+		func(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+			time.Sleep(5 * time.Millisecond)
+
+			lock.Lock()
+			processed = append(processed, update.Message.Text)
+			lock.Unlock()
+		},
+	)
+
+	dispatcher := telejoon.NewDispatcher(processor).
+		WithKey(func(update tgbotapi.Update) (int64, bool) {
+			return 1, true
+		}).
+		WithQueueSize(-1)
+
+	updates := make(chan tgbotapi.Update, 5)
+
+	for i := 0; i < 5; i++ {
+		updates <- tgbotapi.Update{Message: &structs.Message{Text: strconv.Itoa(i)}}
+	}
+
+	close(updates)
+
+	if err := dispatcher.RunUpdates(context.Background(), nil, updates); err != nil {
+		t.Fatalf("expected the updates to be drained, got %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(processed) != 5 {
+		t.Fatalf("expected 5 processed updates before RunUpdates returns, got %d", len(processed))
+	}
+
+	for i, text := range processed {
+		if text != strconv.Itoa(i) {
+			t.Fatalf("expected updates in order, got %v", processed)
+		}
+	}
+}
@@ -1,9 +1,26 @@
 package telejoon
 
+import (
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+// DynamicHandler is the default handler of a static menu, it handles the messages that no other dynamic handler of
+// the menu matches.
+//
+// The dynamic handlers are matched by the content of the message, the most specific first: successful payment, web
+// app data, story, poll, dice, venue, location, contact, media group, animation, video, photo, document, voice, audio,
+// sticker and video note. A venue falls back to the location handler, an animation to the document handler and a part
+// of an album without a media group handler to the handler of its media.
+//
+// Games, invoices, passport data, shared users and chats, giveaways and the service messages (new chat members, left
+// chat member, pinned message, ...) have no handler of their own and are passed to the default handler.
 type DynamicHandler struct {
 	UpdateHandler
 }
 
+// The names of the dynamic handlers, see DynamicHandler for their precedence.
 const (
 	DefaultHandler   = "DEFAULT"
 	TextHandler      = "TEXT"
@@ -19,6 +36,12 @@ const (
 	VenueHandler     = "VENUE"
 	PollHandler      = "POLL"
 	DiceHandler      = "DICE"
+
+	AnimationHandler         = "ANIMATION"
+	WebAppDataHandler        = "WEB_APP_DATA"
+	SuccessfulPaymentHandler = "SUCCESSFUL_PAYMENT"
+	StoryHandler             = "STORY"
+	MediaGroupHandler        = "MEDIA_GROUP"
 )
 
 type DynamicHandlerText struct {
@@ -138,7 +161,119 @@ func NewDynamicHandlerDice(handler UpdateHandler) Handler {
 	return DynamicHandlerDice{UpdateHandler: handler}
 }
 
+type DynamicHandlerAnimation struct {
+	UpdateHandler
+}
+
+type DynamicHandlerWebAppData struct {
+	UpdateHandler
+}
+
+type DynamicHandlerSuccessfulPayment struct {
+	UpdateHandler
+}
+
+type DynamicHandlerStory struct {
+	UpdateHandler
+}
+
+// DynamicHandlerMediaGroup handles the messages of an album at once, use StateUpdate.MediaGroup to get them. In the
+// channel engine it handles the posts of an album, an edited post of an album is handled alone.
+type DynamicHandlerMediaGroup struct {
+	UpdateHandler
+
+	window time.Duration
+}
+
+// NewDynamicHandlerAnimation creates a new DynamicHandlerAnimation
+func NewDynamicHandlerAnimation(handler UpdateHandler) Handler {
+	return DynamicHandlerAnimation{UpdateHandler: handler}
+}
+
+// NewDynamicHandlerWebAppData creates a new DynamicHandlerWebAppData
+func NewDynamicHandlerWebAppData(handler UpdateHandler) Handler {
+	return DynamicHandlerWebAppData{UpdateHandler: handler}
+}
+
+// NewDynamicHandlerSuccessfulPayment creates a new DynamicHandlerSuccessfulPayment
+func NewDynamicHandlerSuccessfulPayment(handler UpdateHandler) Handler {
+	return DynamicHandlerSuccessfulPayment{UpdateHandler: handler}
+}
+
+// NewDynamicHandlerStory creates a new DynamicHandlerStory
+func NewDynamicHandlerStory(handler UpdateHandler) Handler {
+	return DynamicHandlerStory{UpdateHandler: handler}
+}
+
+// NewDynamicHandlerMediaGroup creates a new DynamicHandlerMediaGroup, the messages of an album are buffered for the
+// window after its first message and the handler is called once with all of them in order. window defaults to a
+// second when it's 0.
+func NewDynamicHandlerMediaGroup(handler UpdateHandler, window time.Duration) Handler {
+	return DynamicHandlerMediaGroup{UpdateHandler: handler, window: window}
+}
+
 // NewDefaultHandler creates a new DefaultHandler
 func NewDefaultHandler(handler UpdateHandler) Handler {
 	return DynamicHandler{UpdateHandler: handler}
 }
+
+// messageHandlerNames returns the dynamic handler names matching the content of the message, in the precedence
+// documented on DynamicHandler.
+func messageHandlerNames(message *structs.Message) []string {
+	var names []string
+
+	switch {
+	case message.SuccessfulPayment != nil:
+		return []string{SuccessfulPaymentHandler}
+	case message.WebAppData != nil:
+		return []string{WebAppDataHandler}
+	case message.Story != nil:
+		return []string{StoryHandler}
+	case message.Poll != nil:
+		return []string{PollHandler}
+	case message.Dice != nil:
+		return []string{DiceHandler}
+	case message.Venue != nil:
+		return []string{VenueHandler, LocationHandler}
+	case message.Location != nil:
+		return []string{LocationHandler}
+	case message.Contact != nil:
+		return []string{ContactHandler}
+	}
+
+	if message.MediaGroupId != "" {
+		names = append(names, MediaGroupHandler)
+	}
+
+	switch {
+	case message.Animation != nil:
+		names = append(names, AnimationHandler, DocumentHandler)
+	case message.Video != nil:
+		names = append(names, VideoHandler)
+	case message.Photo != nil:
+		names = append(names, PhotoHandler)
+	case message.Document != nil:
+		names = append(names, DocumentHandler)
+	case message.Voice != nil:
+		names = append(names, VoiceHandler)
+	case message.Audio != nil:
+		names = append(names, AudioHandler)
+	case message.Sticker != nil:
+		names = append(names, StickerHandler)
+	case message.VideoNote != nil:
+		names = append(names, VideoNoteHandler)
+	}
+
+	return names
+}
+
+// getDynamicHandler returns the first handler matching the content of the message, or the default handler.
+func getDynamicHandler(handlers map[string]Handler, message *structs.Message) Handler {
+	for _, name := range messageHandlerNames(message) {
+		if handler := handlers[name]; handler != nil {
+			return handler
+		}
+	}
+
+	return handlers[DefaultHandler]
+}
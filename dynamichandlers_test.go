@@ -0,0 +1,144 @@
+package telejoon_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestDynamicHandlers_Precedence(t *testing.T) {
+	var handled []string
+
+	handlers := map[string]func(handler telejoon.UpdateHandler) telejoon.Handler{
+		"default":            telejoon.NewDefaultHandler,
+		"text":               telejoon.NewDynamicHandlerText,
+		"photo":              telejoon.NewDynamicHandlerPhoto,
+		"document":           telejoon.NewDynamicHandlerDocument,
+		"sticker":            telejoon.NewDynamicHandlerSticker,
+		"location":           telejoon.NewDynamicHandlerLocation,
+		"venue":              telejoon.NewDynamicHandlerVenue,
+		"poll":               telejoon.NewDynamicHandlerPoll,
+		"dice":               telejoon.NewDynamicHandlerDice,
+		"animation":          telejoon.NewDynamicHandlerAnimation,
+		"web app data":       telejoon.NewDynamicHandlerWebAppData,
+		"successful payment": telejoon.NewDynamicHandlerSuccessfulPayment,
+		"story":              telejoon.NewDynamicHandlerStory,
+	}
+
+	tests := []struct {
+		name     string
+		handlers []string
+		message  *structs.Message
+		expected []string
+	}{
+		{
+			name:     "venue before location",
+			handlers: []string{"location", "venue"},
+			message:  &structs.Message{Venue: &structs.Venue{}, Location: &structs.Location{}},
+			expected: []string{"venue"},
+		},
+		{
+			name:     "venue falls back to location",
+			handlers: []string{"location"},
+			message:  &structs.Message{Venue: &structs.Venue{}, Location: &structs.Location{}},
+			expected: []string{"location"},
+		},
+		{
+			name:     "animation before document",
+			handlers: []string{"document", "animation"},
+			message:  &structs.Message{Animation: &structs.Animation{}, Document: &structs.Document{}},
+			expected: []string{"animation"},
+		},
+		{
+			name:     "animation falls back to document",
+			handlers: []string{"document"},
+			message:  &structs.Message{Animation: &structs.Animation{}, Document: &structs.Document{}},
+			expected: []string{"document"},
+		},
+		{
+			name:     "poll",
+			handlers: []string{"poll", "dice"},
+			message:  &structs.Message{Poll: &structs.Poll{}},
+			expected: []string{"poll"},
+		},
+		{
+			name:     "dice",
+			handlers: []string{"poll", "dice"},
+			message:  &structs.Message{Dice: &structs.Dice{}},
+			expected: []string{"dice"},
+		},
+		{
+			name:     "web app data",
+			handlers: []string{"web app data", "text"},
+			message:  &structs.Message{WebAppData: &structs.WebAppData{}},
+			expected: []string{"web app data"},
+		},
+		{
+			name:     "successful payment",
+			handlers: []string{"successful payment", "default"},
+			message:  &structs.Message{SuccessfulPayment: &structs.SuccessfulPayment{}},
+			expected: []string{"successful payment"},
+		},
+		{
+			name:     "story",
+			handlers: []string{"story", "photo"},
+			message:  &structs.Message{Story: &structs.Story{}},
+			expected: []string{"story"},
+		},
+		{
+			name:     "photo of an album without a media group handler",
+			handlers: []string{"photo"},
+			message:  &structs.Message{MediaGroupId: "album", Photo: []structs.PhotoSize{{FileId: "photo"}}},
+			expected: []string{"photo"},
+		},
+		{
+			name:     "default handler",
+			handlers: []string{"photo", "default"},
+			message:  &structs.Message{Sticker: &structs.Sticker{}},
+			expected: []string{"default"},
+		},
+		{
+			name:     "no handler",
+			handlers: []string{"photo"},
+			message:  &structs.Message{Sticker: &structs.Sticker{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+
+			var dynamicHandlers []telejoon.Handler
+
+			for _, name := range tt.handlers {
+				name := name
+
+				dynamicHandlers = append(dynamicHandlers, handlers[name](func(
+					client *tgbotapi.TelegramBot,
+					update *telejoon.StateUpdate,
+				) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+					handled = append(handled, name)
+
+					return nil, false
+				}))
+			}
+
+			// the menu has no text, so nothing is sent to the chat
+			engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+				AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil, dynamicHandlers...))
+
+			tt.message.From = &structs.User{Id: 1}
+			tt.message.Chat = &structs.Chat{Id: 1, Type: "private"}
+
+			engine.Process(nil, tgbotapi.Update{Message: tt.message})
+
+			if !reflect.DeepEqual(handled, tt.expected) {
+				t.Fatalf("expected %v to be handled, got %v", tt.expected, handled)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package telejoon
+
+// InlineButtonFormation returns the formation of the buttons of the builder shown to an update built outside the
+// engines, so the update has no storage.
+func InlineButtonFormation(builder *InlineActionBuilder) []int {
+	update := &StateUpdate{}
+
+	if err := builder.addDeferredButtons(update); err != nil {
+		return nil
+	}
+
+	snapshot := builder.snapshot()
+
+	_, formation := snapshot.availableButtons(update, snapshot.conditionResults(update))
+
+	return formation
+}
+
+// PaginationFormation returns the formation of the buttons of the first page.
+func PaginationFormation(p *InlinePagination) []int {
+	return InlineButtonFormation(p.build(&StateUpdate{}))
+}
+
+// ParseCommand parses a "/name@bot args" text into its parts.
+var ParseCommand = parseCommand
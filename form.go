@@ -0,0 +1,635 @@
+package telejoon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+type FormFieldKind string
+
+const (
+	FormFieldKindText     FormFieldKind = "TEXT"
+	FormFieldKindNumber   FormFieldKind = "NUMBER"
+	FormFieldKindChoice   FormFieldKind = "CHOICE"
+	FormFieldKindContact  FormFieldKind = "CONTACT"
+	FormFieldKindLocation FormFieldKind = "LOCATION"
+	FormFieldKindPhoto    FormFieldKind = "PHOTO"
+)
+
+// FormValidator validates the value of a field, the value is a string for text, choice and photo fields, a float64
+// for number fields, a *structs.Contact for contact fields and a *structs.Location for location fields.
+type FormValidator func(update *StateUpdate, value interface{}) bool
+
+type formValidator struct {
+	validate FormValidator
+	errText  TextBuilder
+}
+
+// FormChoice is an option of a choice field, value is stored when the label is selected.
+type FormChoice struct {
+	value string
+	label TextBuilder
+}
+
+// NewFormChoice creates a new FormChoice.
+func NewFormChoice(value string, label TextBuilder) FormChoice {
+	return FormChoice{
+		value: value,
+		label: label,
+	}
+}
+
+// FormField is a step of a Form.
+type FormField struct {
+	lock sync.Mutex
+
+	name   string
+	kind   FormFieldKind
+	prompt TextBuilder
+
+	choices []FormChoice
+
+	optional bool
+
+	validators []formValidator
+
+	invalidText TextBuilder
+}
+
+func newFormField(kind FormFieldKind, name string, prompt TextBuilder) *FormField {
+	return &FormField{
+		name:   name,
+		kind:   kind,
+		prompt: prompt,
+	}
+}
+
+// NewFormTextField creates a field that collects a text.
+func NewFormTextField(name string, prompt TextBuilder) *FormField {
+	return newFormField(FormFieldKindText, name, prompt)
+}
+
+// NewFormNumberField creates a field that collects a number.
+func NewFormNumberField(name string, prompt TextBuilder) *FormField {
+	return newFormField(FormFieldKindNumber, name, prompt)
+}
+
+// NewFormChoiceField creates a field that collects one of the choices, shown as buttons.
+func NewFormChoiceField(name string, prompt TextBuilder, choices ...FormChoice) *FormField {
+	field := newFormField(FormFieldKindChoice, name, prompt)
+	field.choices = choices
+
+	return field
+}
+
+// NewFormContactField creates a field that collects a shared contact.
+func NewFormContactField(name string, prompt TextBuilder) *FormField {
+	return newFormField(FormFieldKindContact, name, prompt)
+}
+
+// NewFormLocationField creates a field that collects a shared location.
+func NewFormLocationField(name string, prompt TextBuilder) *FormField {
+	return newFormField(FormFieldKindLocation, name, prompt)
+}
+
+// NewFormPhotoField creates a field that collects the file id of the largest size of a photo.
+func NewFormPhotoField(name string, prompt TextBuilder) *FormField {
+	return newFormField(FormFieldKindPhoto, name, prompt)
+}
+
+// Optional shows the skip button for the field.
+func (f *FormField) Optional() *FormField {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.optional = true
+
+	return f
+}
+
+// AddValidator adds a validator to the field, errText is replied when the value is invalid.
+func (f *FormField) AddValidator(validator FormValidator, errText TextBuilder) *FormField {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.validators = append(f.validators, formValidator{
+		validate: validator,
+		errText:  errText,
+	})
+
+	return f
+}
+
+// WithInvalidText sets the text replied when the message isn't of the kind of the field, defaults to the prompt.
+func (f *FormField) WithInvalidText(text TextBuilder) *FormField {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.invalidText = text
+
+	return f
+}
+
+// parse returns the value of the field from the message of the update.
+func (f *FormField) parse(update *StateUpdate) (interface{}, bool) {
+	msg := update.Update.Message
+
+	switch f.kind {
+	case FormFieldKindText:
+		if msg.Text != "" {
+			return msg.Text, true
+		}
+	case FormFieldKindNumber:
+		// NaN and the infinities can't be encoded as JSON
+		number, err := strconv.ParseFloat(strings.TrimSpace(msg.Text), 64)
+		if err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+			return number, true
+		}
+	case FormFieldKindChoice:
+		for _, choice := range f.choices {
+			if msg.Text != "" && choice.label.String(update) == msg.Text {
+				return choice.value, true
+			}
+		}
+	case FormFieldKindContact:
+		if msg.Contact != nil {
+			return msg.Contact, true
+		}
+	case FormFieldKindLocation:
+		if msg.Location != nil {
+			return msg.Location, true
+		}
+	case FormFieldKindPhoto:
+		if len(msg.Photo) > 0 {
+			return msg.Photo[len(msg.Photo)-1].FileId, true
+		}
+	}
+
+	return nil, false
+}
+
+// FormValues are the collected values of a Form by the field names.
+type FormValues map[string]json.RawMessage
+
+// Has reports whether the field has a value, it's false for the skipped fields.
+func (v FormValues) Has(name string) bool {
+	_, ok := v[name]
+
+	return ok
+}
+
+// Decode decodes the value of the field into target.
+func (v FormValues) Decode(name string, target interface{}) error {
+	data, ok := v[name]
+	if !ok {
+		return fmt.Errorf("form_value_not_found: %s", name)
+	}
+
+	return json.Unmarshal(data, target)
+}
+
+// String returns the value of a text, choice or photo field.
+func (v FormValues) String(name string) string {
+	var value string
+
+	_ = v.Decode(name, &value)
+
+	return value
+}
+
+// Float returns the value of a number field.
+func (v FormValues) Float(name string) float64 {
+	var value float64
+
+	_ = v.Decode(name, &value)
+
+	return value
+}
+
+// Contact returns the value of a contact field.
+func (v FormValues) Contact(name string) *structs.Contact {
+	var value *structs.Contact
+
+	_ = v.Decode(name, &value)
+
+	return value
+}
+
+// Location returns the value of a location field.
+func (v FormValues) Location(name string) *structs.Location {
+	var value *structs.Location
+
+	_ = v.Decode(name, &value)
+
+	return value
+}
+
+// FormSubmitHandler receives the collected values, the values are kept if it returns an error.
+// The user is switched to the default state if it returns a nil SwitchAction.
+type FormSubmitHandler func(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	values FormValues,
+) (SwitchAction, error)
+
+// Form collects the values of its fields step by step, each field is a static menu state named "<form>.<field>".
+// Use Start or StartState to switch to the form.
+type Form struct {
+	lock sync.Mutex
+
+	name string
+
+	fields []*FormField
+
+	onSubmit FormSubmitHandler
+
+	repo SessionRepository
+
+	review func(update *StateUpdate, values FormValues) string
+
+	skipButton   TextBuilder
+	backButton   TextBuilder
+	cancelButton TextBuilder
+	submitButton TextBuilder
+
+	cancelAction SwitchAction
+
+	onErr func(client *tgbotapi.TelegramBot, update tgbotapi.Update, err error)
+}
+
+// NewForm creates a new Form keeping the values in memory.
+func NewForm(name string, onSubmit FormSubmitHandler) *Form {
+	return &Form{
+		name:         name,
+		onSubmit:     onSubmit,
+		repo:         NewDefaultSessionRepository(),
+		skipButton:   NewStaticText("Skip"),
+		backButton:   NewStaticText("Back"),
+		cancelButton: NewStaticText("Cancel"),
+		submitButton: NewStaticText("Submit"),
+		cancelAction: NewSwitchActionHome(),
+	}
+}
+
+// AddField adds a field to the form.
+func (f *Form) AddField(field *FormField) *Form {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.fields = append(f.fields, field)
+
+	return f
+}
+
+// WithRepository keeps the values in the repository, it shouldn't be shared with other forms or the sessions.
+func (f *Form) WithRepository(repo SessionRepository) *Form {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.repo = repo
+
+	return f
+}
+
+// WithReview adds a review step after the last field, showing the text returned by review with the submit button.
+func (f *Form) WithReview(review func(update *StateUpdate, values FormValues) string) *Form {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.review = review
+
+	return f
+}
+
+// WithButtons sets the labels of the skip, back, cancel and submit buttons.
+func (f *Form) WithButtons(skip, back, cancel, submit TextBuilder) *Form {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.skipButton = skip
+	f.backButton = back
+	f.cancelButton = cancel
+	f.submitButton = submit
+
+	return f
+}
+
+// WithCancelAction sets where the user is switched when the form is cancelled, defaults to the default state.
+func (f *Form) WithCancelAction(action SwitchAction) *Form {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.cancelAction = action
+
+	return f
+}
+
+// StartState returns the state of the first field.
+func (f *Form) StartState() string {
+	return f.fieldState(0)
+}
+
+// Start returns a SwitchAction to the first field, the previous values are cleared when the form is entered.
+func (f *Form) Start() SwitchAction {
+	return NewSwitchActionState(f.StartState())
+}
+
+func (f *Form) fieldState(index int) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(f.fields) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s.%s", f.name, f.fields[index].name)
+}
+
+func (f *Form) reviewState() string {
+	return fmt.Sprintf("%s.Review", f.name)
+}
+
+// isFormState reports whether the state belongs to the form.
+func (f *Form) isFormState(state string) bool {
+	if state == f.reviewState() {
+		return true
+	}
+
+	for i := range f.fields {
+		if f.fieldState(i) == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+// staticMenus returns the static menus of the fields and the review step by their states.
+func (f *Form) staticMenus(onErr func(*tgbotapi.TelegramBot, tgbotapi.Update, error)) map[string]*StaticMenu {
+	f.lock.Lock()
+	f.onErr = onErr
+	fields := f.fields
+	review := f.review
+	f.lock.Unlock()
+
+	menus := map[string]*StaticMenu{}
+
+	for i := range fields {
+		menu := NewStaticMenu(fields[i].prompt, f.fieldActionBuilder(i), NewDefaultHandler(f.fieldHandler(i)))
+
+		if i == 0 {
+			menu.OnEnter(func(
+				client *tgbotapi.TelegramBot, update *StateUpdate, from, _ string) (SwitchAction, ShouldPass) {
+
+				if !f.isFormState(from) {
+					if err := f.clearValues(update); err != nil {
+						f.reportErr(client, update, err)
+					}
+				}
+
+				return nil, true
+			})
+		}
+
+		menus[f.fieldState(i)] = menu
+	}
+
+	if review != nil {
+		menus[f.reviewState()] = NewStaticMenu(
+			NewDeferredText(func(update *StateUpdate) string {
+				values, err := f.loadValues(update)
+				if err != nil {
+					return ""
+				}
+
+				return review(update, values)
+			}),
+			NewDeferredActionBuilder(func(update *StateUpdate) *ActionBuilder {
+				return NewStaticActionBuilder().
+					AddRawButton(f.submitButton).
+					AddRawButton(f.backButton, NewButtonOptions(true, false)).
+					AddRawButton(f.cancelButton)
+			}),
+			NewDefaultHandler(f.reviewHandler()),
+		)
+	}
+
+	return menus
+}
+
+func (f *Form) fieldActionBuilder(index int) DeferredActionBuilder {
+	return NewDeferredActionBuilder(func(update *StateUpdate) *ActionBuilder {
+		field := f.fields[index]
+
+		actions := NewStaticActionBuilder()
+
+		for _, choice := range field.choices {
+			actions.AddRawButton(choice.label)
+		}
+
+		navigationOpts := NewButtonOptions(len(field.choices) > 0, false)
+
+		if field.optional {
+			actions.AddRawButton(f.skipButton, navigationOpts)
+			navigationOpts = nil
+		}
+
+		if index > 0 {
+			actions.AddRawButton(f.backButton, navigationOpts)
+			navigationOpts = nil
+		}
+
+		return actions.AddRawButton(f.cancelButton, navigationOpts)
+	})
+}
+
+func (f *Form) fieldHandler(index int) UpdateHandler {
+	return func(client *tgbotapi.TelegramBot, update *StateUpdate) (SwitchAction, ShouldPass) {
+		field := f.fields[index]
+
+		text := update.Update.Message.Text
+
+		if text != "" {
+			switch {
+			case text == f.cancelButton.String(update):
+				return f.cancel(client, update), false
+			case index > 0 && text == f.backButton.String(update):
+				return NewSwitchActionState(f.fieldState(index - 1)), false
+			case field.optional && text == f.skipButton.String(update):
+				if err := f.setValue(update, field.name, nil); err != nil {
+					f.reportErr(client, update, err)
+					return nil, false
+				}
+
+				return f.next(client, update, index), false
+			}
+		}
+
+		value, ok := field.parse(update)
+		if !ok {
+			invalidText := field.invalidText
+			if invalidText == nil {
+				invalidText = field.prompt
+			}
+
+			f.reply(client, update, invalidText)
+
+			return nil, false
+		}
+
+		for _, validator := range field.validators {
+			if !validator.validate(update, value) {
+				f.reply(client, update, validator.errText)
+				return nil, false
+			}
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			f.reportErr(client, update, fmt.Errorf("error_encoding_form_value: %s, %w", field.name, err))
+			return nil, false
+		}
+
+		if err := f.setValue(update, field.name, data); err != nil {
+			f.reportErr(client, update, err)
+			return nil, false
+		}
+
+		return f.next(client, update, index), false
+	}
+}
+
+func (f *Form) reviewHandler() UpdateHandler {
+	return func(client *tgbotapi.TelegramBot, update *StateUpdate) (SwitchAction, ShouldPass) {
+		switch update.Update.Message.Text {
+		case f.submitButton.String(update):
+			return f.submit(client, update), false
+		case f.backButton.String(update):
+			return NewSwitchActionState(f.fieldState(len(f.fields) - 1)), false
+		case f.cancelButton.String(update):
+			return f.cancel(client, update), false
+		}
+
+		return NewSwitchActionState(f.reviewState()), false
+	}
+}
+
+// next returns the SwitchAction to the field after index, or to the review step or submits the form.
+func (f *Form) next(client *tgbotapi.TelegramBot, update *StateUpdate, index int) SwitchAction {
+	if index+1 < len(f.fields) {
+		return NewSwitchActionState(f.fieldState(index + 1))
+	}
+
+	if f.review != nil {
+		return NewSwitchActionState(f.reviewState())
+	}
+
+	return f.submit(client, update)
+}
+
+func (f *Form) submit(client *tgbotapi.TelegramBot, update *StateUpdate) SwitchAction {
+	values, err := f.loadValues(update)
+	if err != nil {
+		f.reportErr(client, update, err)
+		return nil
+	}
+
+	switchAction, err := f.onSubmit(client, update, values)
+	if err != nil {
+		f.reportErr(client, update, fmt.Errorf("error_submitting_form: %s, %w", f.name, err))
+		return nil
+	}
+
+	if err := f.clearValues(update); err != nil {
+		f.reportErr(client, update, err)
+	}
+
+	if switchAction == nil {
+		return NewSwitchActionHome()
+	}
+
+	return switchAction
+}
+
+func (f *Form) cancel(client *tgbotapi.TelegramBot, update *StateUpdate) SwitchAction {
+	if err := f.clearValues(update); err != nil {
+		f.reportErr(client, update, err)
+	}
+
+	return f.cancelAction
+}
+
+func (f *Form) loadValues(update *StateUpdate) (FormValues, error) {
+	values := FormValues{}
+
+	data, err := f.repo.LoadSession(update.Context(), update.chatID, update.userID)
+	if err != nil {
+		return nil, fmt.Errorf("error_loading_form_values: %s, %w", f.name, err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("error_decoding_form_values: %s, %w", f.name, err)
+		}
+	}
+
+	return values, nil
+}
+
+// setValue sets the value of a field, a nil value removes it.
+func (f *Form) setValue(update *StateUpdate, name string, value json.RawMessage) error {
+	values, err := f.loadValues(update)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		delete(values, name)
+	} else {
+		values[name] = value
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("error_encoding_form_values: %s, %w", f.name, err)
+	}
+
+	if err := f.repo.SaveSession(update.Context(), update.chatID, update.userID, data); err != nil {
+		return fmt.Errorf("error_saving_form_values: %s, %w", f.name, err)
+	}
+
+	return nil
+}
+
+func (f *Form) clearValues(update *StateUpdate) error {
+	if err := f.repo.DeleteSession(update.Context(), update.chatID, update.userID); err != nil {
+		return fmt.Errorf("error_clearing_form_values: %s, %w", f.name, err)
+	}
+
+	return nil
+}
+
+// reply sends the text to the chat, an empty text isn't sent like the static menus.
+func (f *Form) reply(client *tgbotapi.TelegramBot, update *StateUpdate, text TextBuilder) {
+	replyText := text.String(update)
+	if replyText == "" {
+		return
+	}
+
+	if _, err := client.Send(client.Message().SetText(replyText).SetChatId(update.chatID)); err != nil {
+		f.reportErr(client, update, fmt.Errorf("error_sending_message_to_chat: %d, %w", update.chatID, err))
+	}
+}
+
+func (f *Form) reportErr(client *tgbotapi.TelegramBot, update *StateUpdate, err error) {
+	if f.onErr != nil {
+		f.onErr(client, update.Update, err)
+	}
+}
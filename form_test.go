@@ -0,0 +1,178 @@
+package telejoon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telejoon"
+)
+
+type formTest struct {
+	t *testing.T
+
+	users  telejoon.UserRepository
+	values telejoon.SessionRepository
+	engine *telejoon.EngineWithPrivateStateHandlers
+
+	invalid   int
+	reviewed  []telejoon.FormValues
+	submitted []telejoon.FormValues
+}
+
+// newFormTest returns an engine with a signup form started by "start", the texts are empty so nothing is sent.
+func newFormTest(t *testing.T) *formTest {
+	ft := &formTest{
+		t:      t,
+		users:  telejoon.NewDefaultUserRepository(),
+		values: telejoon.NewDefaultSessionRepository(),
+	}
+
+	form := telejoon.NewForm("Signup", func(
+		client *tgbotapi.TelegramBot,
+		update *telejoon.StateUpdate,
+		values telejoon.FormValues,
+	) (telejoon.SwitchAction, error) {
+
+		ft.submitted = append(ft.submitted, values)
+
+		return nil, nil
+	}).
+		WithRepository(ft.values).
+		WithReview(func(update *telejoon.StateUpdate, values telejoon.FormValues) string {
+			ft.reviewed = append(ft.reviewed, values)
+
+			return ""
+		}).
+		AddField(telejoon.NewFormTextField("Name", telejoon.NewStaticText(""))).
+		AddField(telejoon.NewFormNumberField("Age", telejoon.NewStaticText("")).
+			Optional().
+			WithInvalidText(telejoon.NewDeferredText(func(update *telejoon.StateUpdate) string {
+				ft.invalid++
+
+				return ""
+			}))).
+		AddField(telejoon.NewFormChoiceField("Color", telejoon.NewStaticText(""),
+			telejoon.NewFormChoice("blue", telejoon.NewStaticText("Blue")),
+			telejoon.NewFormChoice("red", telejoon.NewStaticText("Red"))))
+
+	ft.engine = telejoon.WithPrivateStateHandlers(ft.users, "Home").
+		AddGlobalStateCommand("home", "Home").
+		AddForm(form).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil,
+			telejoon.NewDynamicHandlerText(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				if update.Update.Message.Text == "start" {
+					return form.Start(), false
+				}
+
+				return nil, true
+			})))
+
+	return ft
+}
+
+// send processes the text and expects the user to be in state afterwards.
+func (ft *formTest) send(text, state string) {
+	ft.t.Helper()
+
+	ft.engine.Process(nil, privateTextUpdate(text))
+
+	if current, _ := ft.users.GetUserState(1); current != state {
+		ft.t.Fatalf("expected state %q after %q, got %q", state, text, current)
+	}
+}
+
+func TestForm_Navigation(t *testing.T) {
+	ft := newFormTest(t)
+
+	ft.send("start", "Signup.Name")
+	ft.send("Ali", "Signup.Age")
+	ft.send("Back", "Signup.Name")
+	ft.send("Ali", "Signup.Age")
+	ft.send("Skip", "Signup.Color")
+	ft.send("Green", "Signup.Color")
+	ft.send("Blue", "Signup.Review")
+	ft.send("Back", "Signup.Color")
+	ft.send("Red", "Signup.Review")
+	ft.send("Submit", "Home")
+
+	if len(ft.reviewed) != 2 {
+		t.Fatalf("expected the review step to be shown twice, got %d", len(ft.reviewed))
+	}
+
+	if len(ft.submitted) != 1 {
+		t.Fatalf("expected the form to be submitted once, got %d", len(ft.submitted))
+	}
+
+	values := ft.submitted[0]
+
+	if values.String("Name") != "Ali" || values.Has("Age") || values.String("Color") != "red" {
+		t.Fatalf("expected Ali without an age and red, got %s", values)
+	}
+
+	if data, _ := ft.values.LoadSession(context.Background(), 1, 1); len(data) > 0 {
+		t.Fatalf("expected the values to be cleared after the submit, got %s", data)
+	}
+}
+
+func TestForm_RejectsNonFiniteNumbers(t *testing.T) {
+	ft := newFormTest(t)
+
+	ft.send("start", "Signup.Name")
+	ft.send("Ali", "Signup.Age")
+
+	for _, text := range []string{"NaN", "Inf", "-inf", "1e999", "old"} {
+		ft.send(text, "Signup.Age")
+	}
+
+	if ft.invalid != 5 {
+		t.Fatalf("expected 5 invalid replies, got %d", ft.invalid)
+	}
+
+	ft.send(" 42 ", "Signup.Color")
+	ft.send("Blue", "Signup.Review")
+	ft.send("Submit", "Home")
+
+	if age := ft.submitted[0].Float("Age"); age != 42 {
+		t.Fatalf("expected age 42, got %v", age)
+	}
+}
+
+func TestForm_ClearsValuesWhenEntered(t *testing.T) {
+	ft := newFormTest(t)
+
+	ft.send("start", "Signup.Name")
+	ft.send("Ali", "Signup.Age")
+	ft.send("30", "Signup.Color")
+
+	// leaving the form without cancelling it keeps the values
+	ft.send("/home", "Home")
+
+	if data, _ := ft.values.LoadSession(context.Background(), 1, 1); len(data) == 0 {
+		t.Fatal("expected the values to be kept after leaving the form")
+	}
+
+	ft.send("start", "Signup.Name")
+
+	if data, _ := ft.values.LoadSession(context.Background(), 1, 1); len(data) > 0 {
+		t.Fatalf("expected the values to be cleared when the form is entered, got %s", data)
+	}
+
+	// going back to the first field keeps the values
+	ft.send("Bob", "Signup.Age")
+	ft.send("Back", "Signup.Name")
+
+	if data, _ := ft.values.LoadSession(context.Background(), 1, 1); len(data) == 0 {
+		t.Fatal("expected the values to be kept when going back to the first field")
+	}
+
+	ft.send("Cancel", "Home")
+
+	if data, _ := ft.values.LoadSession(context.Background(), 1, 1); len(data) > 0 {
+		t.Fatalf("expected the values to be cleared when the form is cancelled, got %s", data)
+	}
+}
@@ -0,0 +1,62 @@
+package telejoon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// GroupStateRepository stores the states of groups and their members.
+// userID is 0 when the state is kept per chat.
+type GroupStateRepository interface {
+	SetGroupState(chatID, userID int64, state string) error
+	GetGroupState(chatID, userID int64) (string, error)
+}
+
+// ContextGroupStateRepository is a GroupStateRepository that receives the context of the update.
+type ContextGroupStateRepository interface {
+	SetGroupStateContext(ctx context.Context, chatID, userID int64, state string) error
+	GetGroupStateContext(ctx context.Context, chatID, userID int64) (string, error)
+}
+
+type groupStateRepositoryAdapter struct {
+	repo GroupStateRepository
+}
+
+// NewContextGroupStateRepository adapts a GroupStateRepository to a ContextGroupStateRepository that ignores the
+// context.
+func NewContextGroupStateRepository(repo GroupStateRepository) ContextGroupStateRepository {
+	return groupStateRepositoryAdapter{repo: repo}
+}
+
+func (g groupStateRepositoryAdapter) SetGroupStateContext(_ context.Context, chatID, userID int64, state string) error {
+	return g.repo.SetGroupState(chatID, userID, state)
+}
+
+func (g groupStateRepositoryAdapter) GetGroupStateContext(_ context.Context, chatID, userID int64) (string, error) {
+	return g.repo.GetGroupState(chatID, userID)
+}
+
+type defaultGroupStateRepository struct {
+	states sync.Map
+}
+
+// NewDefaultGroupStateRepository Factory function for defaultGroupStateRepository.
+func NewDefaultGroupStateRepository() GroupStateRepository {
+	return &defaultGroupStateRepository{
+		states: sync.Map{},
+	}
+}
+
+func (g *defaultGroupStateRepository) SetGroupState(chatID, userID int64, state string) error {
+	g.states.Store(fmt.Sprintf("%d:%d", chatID, userID), state)
+	return nil
+}
+
+func (g *defaultGroupStateRepository) GetGroupState(chatID, userID int64) (string, error) {
+	if state, ok := g.states.Load(fmt.Sprintf("%d:%d", chatID, userID)); ok {
+		return state.(string), nil
+	}
+
+	return "", nil
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/aliforever/go-telegram-bot-api"
 	"github.com/aliforever/go-telegram-bot-api/structs"
 	"github.com/aliforever/go-telegram-bot-api/tools"
-	"strings"
 	"sync"
 )
 
@@ -25,6 +24,17 @@ func (t baseInlineButton) Data(update *StateUpdate) string {
 	return t.data.String(update)
 }
 
+// buildData returns the data, or the error of a data that can fail to build like the data of typed callback buttons.
+func (t baseInlineButton) buildData(update *StateUpdate) (string, error) {
+	if builder, ok := t.data.(interface {
+		build(update *StateUpdate) (string, error)
+	}); ok {
+		return builder.build(update)
+	}
+
+	return t.data.String(update), nil
+}
+
 // Options returns the options
 func (t baseInlineButton) Options() *ButtonOptions {
 	if len(t.options) == 0 {
@@ -97,7 +107,19 @@ type InlineActionBuilder struct {
 
 	inlineMenu string
 
-	buttons []InlineAction
+	definedConditions      map[string]func(update *StateUpdate) bool
+	definedConditionValues map[string]bool
+
+	conditionalButtons []conditionalInlineButtons
+	buttons            []InlineAction
+
+	// callbackActions route the callback queries of their action without being shown.
+	callbackActions []InlineAction
+
+	// deferredButtons adds the buttons when they're built, so routing the callback actions doesn't need them.
+	deferredButtons func(update *StateUpdate, builder *InlineActionBuilder) error
+
+	conditionalButtonFormations []conditionalButtonFormation
 
 	buttonFormation []int
 	maxButtonPerRow int
@@ -264,23 +286,125 @@ func (b *InlineActionBuilder) AddCallbackButton(
 	return b
 }
 
+// deferButtons adds the buttons using add when the builder is built, see deferredButtons.
+func (b *InlineActionBuilder) deferButtons(
+	add func(update *StateUpdate, builder *InlineActionBuilder) error) *InlineActionBuilder {
+
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	b.deferredButtons = add
+
+	return b
+}
+
+// addDeferredButtons adds the deferred buttons once, add runs without holding the lock.
+func (b *InlineActionBuilder) addDeferredButtons(update *StateUpdate) error {
+	b.locker.Lock()
+	add := b.deferredButtons
+	b.deferredButtons = nil
+	b.locker.Unlock()
+
+	if add == nil {
+		return nil
+	}
+
+	return add(update, b)
+}
+
+// addCallbackAction routes the callback queries of the action of the button without showing it, e.g. for the buttons
+// built from the data of the update.
+func (b *InlineActionBuilder) addCallbackAction(button InlineAction) *InlineActionBuilder {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	b.callbackActions = append(b.callbackActions, button)
+
+	return b
+}
+
 func (b *InlineActionBuilder) Build(_ *StateUpdate) *InlineActionBuilder {
 	return b
 }
 
-// buildButtons builds the buttons.
+// buildInlineButtonData returns the data of the button, see baseInlineButton.buildData.
+func buildInlineButtonData(button InlineAction, update *StateUpdate) (string, error) {
+	if builder, ok := button.(interface {
+		buildData(update *StateUpdate) (string, error)
+	}); ok {
+		return builder.buildData(update)
+	}
+
+	return button.Data(update), nil
+}
+
+// inlineActionSnapshot is a copy of the buttons of an InlineActionBuilder, so the conditions and the text builders of
+// the buttons run without holding its lock.
+type inlineActionSnapshot struct {
+	inlineMenu string
+
+	definedConditions      map[string]func(update *StateUpdate) bool
+	definedConditionValues map[string]bool
+
+	conditionalButtons []conditionalInlineButtons
+	buttons            []InlineAction
+	callbackActions    []InlineAction
+
+	conditionalButtonFormations []conditionalButtonFormation
+
+	buttonFormation []int
+	maxButtonPerRow int
+}
+
+// snapshot returns a copy of the buttons of the builder.
+func (b *InlineActionBuilder) snapshot() inlineActionSnapshot {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	definedConditions := make(map[string]func(update *StateUpdate) bool, len(b.definedConditions))
+	for name, cond := range b.definedConditions {
+		definedConditions[name] = cond
+	}
+
+	definedConditionValues := make(map[string]bool, len(b.definedConditionValues))
+	for name, val := range b.definedConditionValues {
+		definedConditionValues[name] = val
+	}
+
+	return inlineActionSnapshot{
+		inlineMenu:                  b.inlineMenu,
+		definedConditions:           definedConditions,
+		definedConditionValues:      definedConditionValues,
+		conditionalButtons:          b.conditionalButtons,
+		buttons:                     b.buttons,
+		callbackActions:             b.callbackActions,
+		conditionalButtonFormations: b.conditionalButtonFormations,
+		buttonFormation:             b.buttonFormation,
+		maxButtonPerRow:             b.maxButtonPerRow,
+	}
+}
+
+// buildButtons builds the buttons, encoding the callback data using codec.
 func (b *InlineActionBuilder) buildButtons(
 	update *StateUpdate,
+	codec CallbackDataCodec,
 	reverseButtonOrderInRow bool,
-) *structs.InlineKeyboardMarkup {
+) (*structs.InlineKeyboardMarkup, error) {
 
-	if len(b.buttons) == 0 {
-		return nil
+	if err := b.addDeferredButtons(update); err != nil {
+		return nil, err
+	}
+
+	snapshot := b.snapshot()
+
+	buttons, buttonFormation := snapshot.availableButtons(update, snapshot.conditionResults(update))
+	if len(buttons) == 0 {
+		return nil, nil
 	}
 
 	var rows []map[string]string
 
-	for _, button := range b.buttons {
+	for _, button := range buttons {
 		name := button.Name(update)
 
 		shouldBreakAfter := false
@@ -302,7 +426,23 @@ func (b *InlineActionBuilder) buildButtons(
 		if val, ok := button.(inlineUrlButton); ok {
 			row["url"] = val.data.String(update)
 		} else {
-			row["callback_data"] = fmt.Sprintf("%s:%s", b.inlineMenu, button.Data(update))
+			buttonData, err := buildInlineButtonData(button, update)
+			if err != nil {
+				return nil, fmt.Errorf("error_building_callback_data: %s, %w", name, err)
+			}
+
+			parts := splitCallbackData(buttonData)
+
+			data, err := codec.Encode(update.Context(), CallbackData{
+				Menu:   snapshot.inlineMenu,
+				Action: parts[0],
+				Args:   parts[1:],
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error_encoding_callback_data: %s, %w", name, err)
+			}
+
+			row["callback_data"] = data
 		}
 
 		rows = append(rows, row)
@@ -314,22 +454,28 @@ func (b *InlineActionBuilder) buildButtons(
 
 	return tools.Keyboards{}.NewInlineKeyboardFromSlicesOfMapWithFormation(
 		rows,
-		b.maxButtonPerRow,
-		b.buttonFormation,
+		snapshot.maxButtonPerRow,
+		buttonFormation,
 		reverseButtonOrderInRow,
-	)
+	), nil
 }
 
+// getByCallbackActionData returns the buttons that can be shown to the update by their action, so the hidden
+// buttons can't be triggered.
 func (b *InlineActionBuilder) getByCallbackActionData(update *StateUpdate) map[string]InlineAction {
-	b.locker.Lock()
-	defer b.locker.Unlock()
+	snapshot := b.snapshot()
 
 	var data = make(map[string]InlineAction)
 
-	for _, button := range b.buttons {
+	for _, button := range snapshot.callbackActions {
+		data[splitCallbackData(button.Data(update))[0]] = button
+	}
+
+	buttons, _ := snapshot.availableButtons(update, snapshot.conditionResults(update))
+
+	for _, button := range buttons {
 		if _, ok := button.(inlineUrlButton); !ok {
-			sp := strings.Split(button.Data(update), ":")
-			data[sp[0]] = button
+			data[splitCallbackData(button.Data(update))[0]] = button
 		}
 	}
 
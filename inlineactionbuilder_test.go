@@ -0,0 +1,95 @@
+package telejoon_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestInlineActionBuilder_HiddenButtonsAreNotRouted(t *testing.T) {
+	var triggered []string
+
+	handler := func(action string) telejoon.CallbackHandler {
+		return func(
+			client *tgbotapi.TelegramBot,
+			update *telejoon.StateUpdate,
+			args ...string,
+		) (telejoon.SwitchAction, error) {
+
+			triggered = append(triggered, action)
+
+			return nil, nil
+		}
+	}
+
+	builder := telejoon.NewInlineActionBuilder().
+		DefineCondition("admin", func(update *telejoon.StateUpdate) bool {
+			return false
+		}).
+		AddDefinedConditionalButtons("admin", nil, telejoon.NewInlineActionBuilder().
+			AddCallbackButton(telejoon.NewStaticText("Ban"), telejoon.NewStaticText("ban"), handler("ban"))).
+		AddVsDefinedConditionalButtons("admin", nil, telejoon.NewInlineActionBuilder().
+			AddCallbackButton(telejoon.NewStaticText("Report"), telejoon.NewStaticText("report"), handler("report")))
+
+	codec := telejoon.NewDefaultCallbackDataCodec()
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithCallbackDataCodec(codec).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+		AddInlineMenu("actions", telejoon.NewInlineMenu(telejoon.NewStaticText(""), builder))
+
+	for _, action := range []string{"ban", "report"} {
+		engine.Process(nil, callbackQueryUpdate(t, codec, telejoon.CallbackData{Menu: "actions", Action: action}))
+	}
+
+	if !reflect.DeepEqual(triggered, []string{"report"}) {
+		t.Fatalf("expected only the shown report button to be triggered, got %v", triggered)
+	}
+}
+
+func TestInlineActionBuilder_ConditionalFormations(t *testing.T) {
+	builder := telejoon.NewInlineActionBuilder()
+
+	builder.
+		AddAlertButton(telejoon.NewStaticText("A"), telejoon.NewStaticText("a"), "").
+		AddAlertButton(telejoon.NewStaticText("B"), telejoon.NewStaticText("b"), "").
+		AddAlertButton(telejoon.NewStaticText("C"), telejoon.NewStaticText("c"), "").
+		SetButtonFormation(1, 1, 1).
+		AddConditionalButtonFormation(func(update *telejoon.StateUpdate) bool {
+			return false
+		}, 3).
+		AddConditionalButtonFormation(func(update *telejoon.StateUpdate) bool {
+			return true
+		}, 2, 1).
+		AddConditionalButtonFormation(func(update *telejoon.StateUpdate) bool {
+			return true
+		}, 1, 2).
+		AddConditionalButtons(func(update *telejoon.StateUpdate) bool {
+			// the conditions run without the lock of the builder
+			builder.SetConditionValue("shown", true)
+
+			return true
+		}, []int{2}, telejoon.NewInlineActionBuilder().
+			AddAlertButton(telejoon.NewStaticText("D"), telejoon.NewStaticText("d"), "").
+			AddAlertButton(telejoon.NewStaticText("E"), telejoon.NewStaticText("e"), ""))
+
+	formation := make(chan []int, 1)
+
+	go func() {
+		formation <- telejoon.InlineButtonFormation(builder)
+	}()
+
+	expected := []int{2, 2, 1}
+
+	select {
+	case got := <-formation:
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected formation %v, got %v", expected, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the conditions to run without the lock of the builder")
+	}
+}
@@ -0,0 +1,172 @@
+package telejoon
+
+type conditionalInlineButtons struct {
+	definedCondition   *string
+	vsDefinedCondition *string
+	cond               func(update *StateUpdate) bool
+
+	buttons []InlineAction
+
+	formation []int
+}
+
+func (b conditionalInlineButtons) canBeShown(update *StateUpdate, conditionResults map[string]bool) bool {
+	cond1 := b.cond == nil || b.cond(update)
+	cond2 := b.definedCondition == nil || conditionResults[*b.definedCondition]
+	cond3 := b.vsDefinedCondition == nil || !conditionResults[*b.vsDefinedCondition]
+
+	return cond1 && cond2 && cond3
+}
+
+// DefineCondition defines a condition that is evaluated for every update.
+func (b *InlineActionBuilder) DefineCondition(name string, cond func(update *StateUpdate) bool) *InlineActionBuilder {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	if b.definedConditions == nil {
+		b.definedConditions = make(map[string]func(update *StateUpdate) bool)
+	}
+
+	b.definedConditions[name] = cond
+
+	return b
+}
+
+// SetConditionValue sets the value of a condition, the conditions defined by DefineCondition take precedence.
+func (b *InlineActionBuilder) SetConditionValue(name string, val bool) *InlineActionBuilder {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	if b.definedConditionValues == nil {
+		b.definedConditionValues = make(map[string]bool)
+	}
+
+	b.definedConditionValues[name] = val
+
+	return b
+}
+
+// AddConditionalButtonFormation sets the formation of the buttons when cond is true, the first matching formation
+// replaces the one set by SetButtonFormation.
+func (b *InlineActionBuilder) AddConditionalButtonFormation(
+	cond func(update *StateUpdate) bool,
+	formation ...int,
+) *InlineActionBuilder {
+
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	b.conditionalButtonFormations = append(b.conditionalButtonFormations, conditionalButtonFormation{
+		cond:      cond,
+		formation: formation,
+	})
+
+	return b
+}
+
+// AddConditionalButtons adds the buttons of the given builder, shown when cond is true.
+func (b *InlineActionBuilder) AddConditionalButtons(
+	cond func(update *StateUpdate) bool,
+	buttonFormation []int,
+	buttons *InlineActionBuilder,
+) *InlineActionBuilder {
+
+	return b.addConditionalButtons(conditionalInlineButtons{cond: cond}, buttonFormation, buttons)
+}
+
+// AddDefinedConditionalButtons adds the buttons of the given builder, shown when the defined condition is true.
+func (b *InlineActionBuilder) AddDefinedConditionalButtons(
+	definedCondition string,
+	buttonFormation []int,
+	buttons *InlineActionBuilder,
+) *InlineActionBuilder {
+
+	return b.addConditionalButtons(
+		conditionalInlineButtons{definedCondition: &definedCondition}, buttonFormation, buttons)
+}
+
+// AddVsDefinedConditionalButtons adds the buttons of the given builder, shown when the defined condition is false.
+func (b *InlineActionBuilder) AddVsDefinedConditionalButtons(
+	vsDefinedCondition string,
+	buttonFormation []int,
+	buttons *InlineActionBuilder,
+) *InlineActionBuilder {
+
+	return b.addConditionalButtons(
+		conditionalInlineButtons{vsDefinedCondition: &vsDefinedCondition}, buttonFormation, buttons)
+}
+
+// addConditionalButtons adds the buttons of the given builder, its conditions and formations are ignored.
+func (b *InlineActionBuilder) addConditionalButtons(
+	conditional conditionalInlineButtons,
+	buttonFormation []int,
+	buttons *InlineActionBuilder,
+) *InlineActionBuilder {
+
+	if buttons == nil {
+		return b
+	}
+
+	buttons.locker.Lock()
+	conditional.buttons = append([]InlineAction(nil), buttons.buttons...)
+	buttons.locker.Unlock()
+
+	if len(conditional.buttons) == 0 {
+		return b
+	}
+
+	conditional.formation = buttonFormation
+
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	b.conditionalButtons = append(b.conditionalButtons, conditional)
+
+	return b
+}
+
+// conditionResults returns the values of the conditions for the update.
+func (s inlineActionSnapshot) conditionResults(update *StateUpdate) map[string]bool {
+	results := make(map[string]bool, len(s.definedConditionValues)+len(s.definedConditions))
+
+	for name, val := range s.definedConditionValues {
+		results[name] = val
+	}
+
+	for name, cond := range s.definedConditions {
+		results[name] = cond(update)
+	}
+
+	return results
+}
+
+// availableButtons returns the buttons that can be shown to the update, the conditional buttons come first, and
+// their formation.
+func (s inlineActionSnapshot) availableButtons(
+	update *StateUpdate,
+	conditionResults map[string]bool,
+) ([]InlineAction, []int) {
+
+	var (
+		buttons   []InlineAction
+		formation []int
+	)
+
+	for _, conditional := range s.conditionalButtons {
+		if conditional.canBeShown(update, conditionResults) {
+			buttons = append(buttons, conditional.buttons...)
+			formation = append(formation, conditional.formation...)
+		}
+	}
+
+	buttonFormation := s.buttonFormation
+
+	for _, conditionalFormation := range s.conditionalButtonFormations {
+		if conditionalFormation.cond(update) {
+			buttonFormation = conditionalFormation.formation
+			break
+		}
+	}
+
+	return append(buttons, s.buttons...), append(formation, buttonFormation...)
+}
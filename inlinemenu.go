@@ -46,7 +46,10 @@ func (i *InlineMenu) processActionBuilder(update *StateUpdate) *InlineActionBuil
 	}
 
 	builder := i.inlineActionBuilder.Build(update)
+
+	builder.locker.Lock()
 	builder.inlineMenu = i.callbackPrefix
+	builder.locker.Unlock()
 
 	return builder
 }
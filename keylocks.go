@@ -0,0 +1,56 @@
+package telejoon
+
+import (
+	"sync"
+)
+
+type keyLock struct {
+	sync.Mutex
+
+	refs int
+}
+
+// keyLocks runs the updates and the scheduled work of each chat and user one at a time, e.g. a state expiry doesn't
+// run alongside the update that resets it.
+type keyLocks struct {
+	lock sync.Mutex
+
+	locks map[[2]int64]*keyLock
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		locks: map[[2]int64]*keyLock{},
+	}
+}
+
+// acquire locks the chat and user until the returned function is called.
+func (k *keyLocks) acquire(chatID, userID int64) func() {
+	key := [2]int64{chatID, userID}
+
+	k.lock.Lock()
+
+	l := k.locks[key]
+	if l == nil {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+
+	l.refs++
+
+	k.lock.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		k.lock.Lock()
+		defer k.lock.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
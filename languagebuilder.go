@@ -8,7 +8,7 @@ import (
 
 type LanguageConfig struct {
 	languages *Languages
-	repo      UserLanguageRepository
+	repo      ContextUserLanguageRepository
 
 	forceChooseLanguage           bool
 	changeLanguageState           string
@@ -16,6 +16,11 @@ type LanguageConfig struct {
 }
 
 func NewLanguageConfig(languages *Languages, repo UserLanguageRepository) *LanguageConfig {
+	return NewLanguageConfigContext(languages, NewContextUserLanguageRepository(repo))
+}
+
+// NewLanguageConfigContext creates a LanguageConfig with a context aware repository.
+func NewLanguageConfigContext(languages *Languages, repo ContextUserLanguageRepository) *LanguageConfig {
 	return &LanguageConfig{
 		languages: languages,
 		repo:      repo,
@@ -1,6 +1,7 @@
 package telejoon
 
 import (
+	"context"
 	"errors"
 	"sync"
 )
@@ -12,6 +13,32 @@ type UserLanguageRepository interface {
 	GetUserLanguage(userID int64) (string, error)
 }
 
+// ContextUserLanguageRepository is a UserLanguageRepository that receives the context of the update.
+type ContextUserLanguageRepository interface {
+	SetUserLanguageContext(ctx context.Context, userID int64, languageTag string) error
+	GetUserLanguageContext(ctx context.Context, userID int64) (string, error)
+}
+
+type userLanguageRepositoryAdapter struct {
+	repo UserLanguageRepository
+}
+
+// NewContextUserLanguageRepository adapts a UserLanguageRepository to a ContextUserLanguageRepository that
+// ignores the context.
+func NewContextUserLanguageRepository(repo UserLanguageRepository) ContextUserLanguageRepository {
+	return userLanguageRepositoryAdapter{repo: repo}
+}
+
+func (u userLanguageRepositoryAdapter) SetUserLanguageContext(
+	_ context.Context, userID int64, languageTag string) error {
+
+	return u.repo.SetUserLanguage(userID, languageTag)
+}
+
+func (u userLanguageRepositoryAdapter) GetUserLanguageContext(_ context.Context, userID int64) (string, error) {
+	return u.repo.GetUserLanguage(userID)
+}
+
 // DefaultUserLanguageRepository is a default implementation of UserLanguageRepository.
 type DefaultUserLanguageRepository struct {
 	languages sync.Map
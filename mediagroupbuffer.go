@@ -0,0 +1,178 @@
+package telejoon
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+const defaultMediaGroupWindow = time.Second
+
+// MediaGroupBuffer buffers the messages of albums until they're handled, it can be shared between instances so the
+// parts received by any of them are handled together.
+type MediaGroupBuffer interface {
+	// AddMessage adds the message to the album and returns true if it's the first message of the album.
+	AddMessage(ctx context.Context, mediaGroupID string, message *structs.Message) (bool, error)
+	// TakeMessages returns the messages of the album and removes it.
+	TakeMessages(ctx context.Context, mediaGroupID string) ([]*structs.Message, error)
+}
+
+type defaultMediaGroupBuffer struct {
+	lock sync.Mutex
+
+	groups map[string][]*structs.Message
+}
+
+// NewDefaultMediaGroupBuffer Factory function for defaultMediaGroupBuffer.
+func NewDefaultMediaGroupBuffer() MediaGroupBuffer {
+	return &defaultMediaGroupBuffer{
+		groups: map[string][]*structs.Message{},
+	}
+}
+
+func (b *defaultMediaGroupBuffer) AddMessage(
+	_ context.Context, mediaGroupID string, message *structs.Message) (bool, error) {
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	first := len(b.groups[mediaGroupID]) == 0
+
+	b.groups[mediaGroupID] = append(b.groups[mediaGroupID], message)
+
+	return first, nil
+}
+
+func (b *defaultMediaGroupBuffer) TakeMessages(_ context.Context, mediaGroupID string) ([]*structs.Message, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	messages := b.groups[mediaGroupID]
+
+	delete(b.groups, mediaGroupID)
+
+	return messages, nil
+}
+
+// bufferWindow returns the window of the handler, defaults to defaultMediaGroupWindow.
+func (h DynamicHandlerMediaGroup) bufferWindow() time.Duration {
+	if h.window <= 0 {
+		return defaultMediaGroupWindow
+	}
+
+	return h.window
+}
+
+// takeMediaGroup takes the messages of the album from the buffer, ordered by their ids.
+func takeMediaGroup(ctx context.Context, buffer MediaGroupBuffer, mediaGroupID string) ([]*structs.Message, error) {
+	messages, err := buffer.TakeMessages(ctx, mediaGroupID)
+	if err != nil {
+		return nil, fmt.Errorf("error_taking_media_group: %s, %w", mediaGroupID, err)
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].MessageId < messages[j].MessageId
+	})
+
+	return messages, nil
+}
+
+// bufferMediaGroup adds the message to its album, the instance receiving the first message calls the handler once
+// with all the messages of the album after the window of the handler. The handler runs while the chat and user are
+// locked, and its session changes are saved.
+func (e *stateEngine) bufferMediaGroup(
+	handler DynamicHandlerMediaGroup, client *tgbotapi.TelegramBot, update *StateUpdate) {
+
+	mediaGroupID := update.Update.Message.MediaGroupId
+
+	first, err := e.mediaGroupBuffer.AddMessage(update.Context(), mediaGroupID, update.Update.Message)
+	if err != nil {
+		e.onErr(client, update.Update, fmt.Errorf("error_buffering_media_group: %s, %w", mediaGroupID, err))
+		return
+	}
+
+	if !first {
+		return
+	}
+
+	albumUpdate := *update
+	albumUpdate.ctx = context.WithoutCancel(update.Context())
+
+	time.AfterFunc(handler.bufferWindow(), func() {
+		defer e.recoverPanic(client, albumUpdate.Update)
+
+		// the album is handled like an update of the user, after the update being processed and with a fresh session
+		unlock := e.lockKey(&albumUpdate)
+		defer unlock()
+
+		if err := e.loadSession(&albumUpdate); err != nil {
+			e.onErr(client, albumUpdate.Update, err)
+			return
+		}
+
+		defer e.saveSession(client, &albumUpdate)
+
+		messages, err := takeMediaGroup(albumUpdate.Context(), e.mediaGroupBuffer, mediaGroupID)
+		if err != nil {
+			e.onErr(client, albumUpdate.Update, err)
+			return
+		}
+
+		albumUpdate.mediaGroup = messages
+
+		switchAction, _ := handler.Handle(client, &albumUpdate)
+		if err := e.processSwitchAction(switchAction, &albumUpdate, client); err != nil {
+			e.onErr(client, albumUpdate.Update, err)
+		}
+	})
+}
+
+// bufferMediaGroup adds the post to its album, the instance receiving the first post calls the handler once with all
+// the posts of the album after the window of the handler.
+func (e *EngineWithChannelHandlers) bufferMediaGroup(
+	handler DynamicHandlerMediaGroup, client *tgbotapi.TelegramBot, update *StateUpdate, post *structs.Message) {
+
+	buffer := e.getMediaGroupBuffer()
+
+	first, err := buffer.AddMessage(update.Context(), post.MediaGroupId, post)
+	if err != nil {
+		e.onErr(client, update.Update, fmt.Errorf("error_buffering_media_group: %s, %w", post.MediaGroupId, err))
+		return
+	}
+
+	if !first {
+		return
+	}
+
+	albumUpdate := *update
+	albumUpdate.ctx = context.WithoutCancel(update.Context())
+
+	time.AfterFunc(handler.bufferWindow(), func() {
+		if panicHandler := e.getPanicHandler(); panicHandler != nil {
+			defer func() {
+				if r := recover(); r != nil {
+					panicHandler(client, albumUpdate.Update, r, string(debug.Stack()))
+				}
+			}()
+		}
+
+		messages, err := takeMediaGroup(albumUpdate.Context(), buffer, post.MediaGroupId)
+		if err != nil {
+			e.onErr(client, albumUpdate.Update, err)
+			return
+		}
+
+		albumUpdate.mediaGroup = messages
+
+		switchAction, _ := handler.Handle(client, &albumUpdate)
+		if err := e.processSwitchAction(switchAction, &albumUpdate, client); err != nil {
+			e.onErr(client, albumUpdate.Update, err)
+		}
+	})
+}
@@ -0,0 +1,356 @@
+package telejoon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+const (
+	paginationItemAction = "item"
+	paginationPageAction = "page"
+	paginationNoopAction = "noop"
+)
+
+// PaginationItem is an item of an InlinePagination, the ID is passed to the selection handler.
+type PaginationItem struct {
+	ID    string
+	Label string
+}
+
+// PaginationProvider provides the items of an InlinePagination.
+type PaginationProvider interface {
+	Count(update *StateUpdate) (int, error)
+	Page(update *StateUpdate, offset, limit int) ([]PaginationItem, error)
+}
+
+type paginationProvider struct {
+	count func(update *StateUpdate) (int, error)
+	page  func(update *StateUpdate, offset, limit int) ([]PaginationItem, error)
+}
+
+// NewPaginationProvider returns a PaginationProvider that calls count and page.
+func NewPaginationProvider(
+	count func(update *StateUpdate) (int, error),
+	page func(update *StateUpdate, offset, limit int) ([]PaginationItem, error),
+) PaginationProvider {
+
+	return paginationProvider{
+		count: count,
+		page:  page,
+	}
+}
+
+func (p paginationProvider) Count(update *StateUpdate) (int, error) {
+	return p.count(update)
+}
+
+func (p paginationProvider) Page(update *StateUpdate, offset, limit int) ([]PaginationItem, error) {
+	return p.page(update, offset, limit)
+}
+
+// PaginationSelectHandler is called with the id of the selected item and the page it was selected on.
+type PaginationSelectHandler func(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	id string,
+	page int,
+) (SwitchAction, error)
+
+// paginationPageKey is the storage key of the page requested by the navigation buttons.
+type paginationPageKey string
+
+type paginationOptions struct {
+	pageSize        int
+	itemFormation   []int
+	maxItemsPerRow  int
+	previousButton  TextBuilder
+	nextButton      TextBuilder
+	pageLabel       func(update *StateUpdate, page, pages int) string
+	itemButtonsOpts []*ButtonOptions
+}
+
+// InlinePagination is an inline menu that lists the items of a PaginationProvider page by page. The navigation
+// buttons edit the message in place, and the page is kept in the callback data of the buttons.
+type InlinePagination struct {
+	lock sync.Mutex
+
+	menu     string
+	provider PaginationProvider
+	onSelect PaginationSelectHandler
+
+	opts paginationOptions
+}
+
+// NewInlinePagination returns an InlinePagination that should be added to the engines as an inline menu named menu,
+// using InlineMenu.
+func NewInlinePagination(
+	menu string, provider PaginationProvider, onSelect PaginationSelectHandler) *InlinePagination {
+
+	return &InlinePagination{
+		menu:     menu,
+		provider: provider,
+		onSelect: onSelect,
+		opts: paginationOptions{
+			pageSize:       5,
+			maxItemsPerRow: 1,
+			previousButton: NewStaticText("«"),
+			nextButton:     NewStaticText("»"),
+			pageLabel: func(_ *StateUpdate, page, pages int) string {
+				return fmt.Sprintf("%d/%d", page+1, pages)
+			},
+		},
+	}
+}
+
+// SetPageSize sets the number of items per page, defaults to 5.
+func (p *InlinePagination) SetPageSize(size int) *InlinePagination {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if size > 0 {
+		p.opts.pageSize = size
+	}
+
+	return p
+}
+
+// SetMaxItemsPerRow sets the maximum number of item buttons per row, defaults to 1.
+func (p *InlinePagination) SetMaxItemsPerRow(max int) *InlinePagination {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if max > 0 {
+		p.opts.maxItemsPerRow = max
+	}
+
+	return p
+}
+
+// SetItemFormation sets the formation of the item buttons, it takes precedence over SetMaxItemsPerRow.
+func (p *InlinePagination) SetItemFormation(formation ...int) *InlinePagination {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.opts.itemFormation = formation
+
+	return p
+}
+
+// SetNavButtons sets the texts of the previous and next page buttons.
+func (p *InlinePagination) SetNavButtons(previous, next TextBuilder) *InlinePagination {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.opts.previousButton = previous
+	p.opts.nextButton = next
+
+	return p
+}
+
+// SetPageLabel sets the label shown between the navigation buttons, page starts from 0.
+func (p *InlinePagination) SetPageLabel(label func(update *StateUpdate, page, pages int) string) *InlinePagination {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.opts.pageLabel = label
+
+	return p
+}
+
+// SetItemButtonOptions sets the options of the item buttons.
+func (p *InlinePagination) SetItemButtonOptions(opts ...*ButtonOptions) *InlinePagination {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.opts.itemButtonsOpts = opts
+
+	return p
+}
+
+// InlineMenu returns the inline menu of the pagination. The page is fetched once each time the menu is sent, and the
+// menu isn't sent when the provider fails.
+func (p *InlinePagination) InlineMenu(text TextBuilder, middlewares ...Middleware) *InlineMenu {
+	return NewInlineMenu(text, NewDeferredInlineActionBuilder(p.build), middlewares...)
+}
+
+// fetch fetches the requested page, clamped to the available pages.
+func (p *InlinePagination) fetch(update *StateUpdate, pageSize int) (page, pages int, items []PaginationItem, err error) {
+	page, _ = update.Get(paginationPageKey(p.menu)).(int)
+
+	count, err := p.provider.Count(update)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error_counting_pagination_items: %s, %w", p.menu, err)
+	}
+
+	pages = (count + pageSize - 1) / pageSize
+	if pages < 1 {
+		pages = 1
+	}
+
+	if page >= pages {
+		page = pages - 1
+	}
+
+	if page < 0 {
+		page = 0
+	}
+
+	items, err = p.provider.Page(update, page*pageSize, pageSize)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error_fetching_pagination_page: %s, %d, %w", p.menu, page, err)
+	}
+
+	return page, pages, items, nil
+}
+
+func (p *InlinePagination) build(update *StateUpdate) *InlineActionBuilder {
+	p.lock.Lock()
+	opts := p.opts
+	p.lock.Unlock()
+
+	// the actions are routed whether or not their buttons are shown, e.g. for a page that has changed since
+	builder := NewInlineActionBuilder().
+		addCallbackAction(inlineCallbackButton{
+			baseInlineButton: baseInlineButton{data: NewStaticText(paginationItemAction)},
+			handler:          p.selectItem,
+		}).
+		addCallbackAction(inlineCallbackButton{
+			baseInlineButton: baseInlineButton{data: NewStaticText(paginationPageAction)},
+			handler:          p.changePage,
+		}).
+		addCallbackAction(inlineAlertButton{
+			baseInlineButton: baseInlineButton{data: NewStaticText(paginationNoopAction)},
+		})
+
+	// the page is only fetched when the buttons are built, not when a callback query is routed
+	return builder.deferButtons(func(update *StateUpdate, builder *InlineActionBuilder) error {
+		page, pages, items, err := p.fetch(update, opts.pageSize)
+		if err != nil {
+			return err
+		}
+
+		pageText := NewStaticText(strconv.Itoa(page))
+
+		for _, item := range items {
+			builder.AddCallbackButton(
+				NewStaticText(item.Label),
+				NewCallbackDataText(paginationItemAction, pageText, NewStaticText(item.ID)),
+				p.selectItem,
+				opts.itemButtonsOpts...,
+			)
+		}
+
+		formation := opts.formation(len(items))
+
+		if pages > 1 {
+			navButtons := 1
+
+			if page > 0 {
+				builder.AddCallbackButton(
+					opts.previousButton,
+					NewCallbackDataText(paginationPageAction, NewStaticText(strconv.Itoa(page-1))),
+					p.changePage,
+				)
+				navButtons++
+			}
+
+			builder.AddAlertButton(
+				NewStaticText(opts.pageLabel(update, page, pages)),
+				NewStaticText(paginationNoopAction),
+				"",
+			)
+
+			if page < pages-1 {
+				builder.AddCallbackButton(
+					opts.nextButton,
+					NewCallbackDataText(paginationPageAction, NewStaticText(strconv.Itoa(page+1))),
+					p.changePage,
+				)
+				navButtons++
+			}
+
+			formation = append(formation, navButtons)
+		}
+
+		builder.SetButtonFormation(formation...)
+
+		return nil
+	})
+}
+
+// formation returns the rows of the item buttons.
+func (o paginationOptions) formation(items int) []int {
+	var formation []int
+
+	for _, row := range o.itemFormation {
+		if items <= 0 {
+			break
+		}
+
+		if row > items {
+			row = items
+		}
+
+		formation = append(formation, row)
+		items -= row
+	}
+
+	for items > 0 {
+		row := o.maxItemsPerRow
+		if row > items {
+			row = items
+		}
+
+		formation = append(formation, row)
+		items -= row
+	}
+
+	return formation
+}
+func (p *InlinePagination) changePage(
+	_ *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	args ...string,
+) (SwitchAction, error) {
+
+	if len(args) != 1 {
+		return nil, &CallbackPayloadError{
+			Action: paginationPageAction,
+			Err:    errors.New("missing_page"),
+		}
+	}
+
+	page, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, &CallbackPayloadError{Action: paginationPageAction, Payload: args[0], Err: err}
+	}
+
+	update.Set(paginationPageKey(p.menu), page)
+
+	return NewSwitchActionInlineMenu(p.menu, true), nil
+}
+
+func (p *InlinePagination) selectItem(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	args ...string,
+) (SwitchAction, error) {
+
+	if len(args) != 2 {
+		return nil, &CallbackPayloadError{
+			Action: paginationItemAction,
+			Err:    errors.New("missing_item"),
+		}
+	}
+
+	page, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, &CallbackPayloadError{Action: paginationItemAction, Payload: args[0], Err: err}
+	}
+
+	return p.onSelect(client, update, args[1], page)
+}
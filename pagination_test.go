@@ -0,0 +1,253 @@
+package telejoon_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+// recordingCodec records the callback data of the built buttons.
+type recordingCodec struct {
+	telejoon.CallbackDataCodec
+
+	lock    sync.Mutex
+	encoded []telejoon.CallbackData
+}
+
+func (c *recordingCodec) Encode(ctx context.Context, data telejoon.CallbackData) (string, error) {
+	c.lock.Lock()
+	c.encoded = append(c.encoded, data)
+	c.lock.Unlock()
+
+	return c.CallbackDataCodec.Encode(ctx, data)
+}
+
+// take returns the recorded callback data and resets it.
+func (c *recordingCodec) take() []telejoon.CallbackData {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	encoded := c.encoded
+	c.encoded = nil
+
+	return encoded
+}
+
+func newPaginationProvider(count int) telejoon.PaginationProvider {
+	return telejoon.NewPaginationProvider(
+		func(update *telejoon.StateUpdate) (int, error) {
+			return count, nil
+		},
+		func(update *telejoon.StateUpdate, offset, limit int) ([]telejoon.PaginationItem, error) {
+			var items []telejoon.PaginationItem
+
+			for i := offset; i < offset+limit && i < count; i++ {
+				items = append(items, telejoon.PaginationItem{ID: fmt.Sprintf("id-%d", i), Label: fmt.Sprintf("Item %d", i)})
+			}
+
+			return items, nil
+		},
+	)
+}
+
+func callbackQueryUpdate(t *testing.T, codec telejoon.CallbackDataCodec, data telejoon.CallbackData) tgbotapi.Update {
+	encoded, err := codec.Encode(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tgbotapi.Update{CallbackQuery: &structs.CallbackQuery{
+		Id:   "1",
+		From: &structs.User{Id: 1},
+		Data: encoded,
+		Message: &structs.Message{
+			MessageId: 1,
+			Chat:      &structs.Chat{Id: 1, Type: "private"},
+		},
+	}}
+}
+
+func TestInlinePagination_ClampsPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		expected []telejoon.CallbackData
+	}{
+		{
+			name: "after the last page",
+			page: "9",
+			expected: []telejoon.CallbackData{
+				{Menu: "list", Action: "item", Args: []string{"2", "id-10"}},
+				{Menu: "list", Action: "item", Args: []string{"2", "id-11"}},
+				{Menu: "list", Action: "page", Args: []string{"1"}},
+				{Menu: "list", Action: "noop", Args: []string{}},
+			},
+		},
+		{
+			name: "before the first page",
+			page: "-4",
+			expected: []telejoon.CallbackData{
+				{Menu: "list", Action: "item", Args: []string{"0", "id-0"}},
+				{Menu: "list", Action: "item", Args: []string{"0", "id-1"}},
+				{Menu: "list", Action: "item", Args: []string{"0", "id-2"}},
+				{Menu: "list", Action: "item", Args: []string{"0", "id-3"}},
+				{Menu: "list", Action: "item", Args: []string{"0", "id-4"}},
+				{Menu: "list", Action: "noop", Args: []string{}},
+				{Menu: "list", Action: "page", Args: []string{"1"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				labels  []string
+				fetches int
+			)
+
+			provider := newPaginationProvider(12)
+
+			codec := &recordingCodec{CallbackDataCodec: telejoon.NewDefaultCallbackDataCodec()}
+
+			pagination := telejoon.NewInlinePagination("list", telejoon.NewPaginationProvider(
+				func(update *telejoon.StateUpdate) (int, error) {
+					fetches++
+
+					return provider.Count(update)
+				},
+				provider.Page,
+			), nil).
+				SetPageLabel(func(update *telejoon.StateUpdate, page, pages int) string {
+					labels = append(labels, fmt.Sprintf("%d/%d", page, pages))
+
+					return "page"
+				})
+
+			// the menu has no text, so it's built but never sent
+			engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+				WithCallbackDataCodec(codec).
+				AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+				AddInlineMenu("list", pagination.InlineMenu(telejoon.NewStaticText("")))
+
+			update := callbackQueryUpdate(t, codec, telejoon.CallbackData{
+				Menu:   "list",
+				Action: "page",
+				Args:   []string{tt.page},
+			})
+
+			codec.take()
+			engine.Process(nil, update)
+
+			// routing the callback query doesn't fetch the page, only rendering the requested page does
+			if fetches != 1 {
+				t.Fatalf("expected the page to be fetched once, got %d", fetches)
+			}
+
+			rendered := codec.take()
+			if len(rendered) != len(tt.expected) {
+				t.Fatalf("expected the rendered page %v, got %v", tt.expected, rendered)
+			}
+
+			for i := range tt.expected {
+				if rendered[i].Action != tt.expected[i].Action ||
+					!reflect.DeepEqual(append([]string{}, rendered[i].Args...), tt.expected[i].Args) {
+
+					t.Fatalf("expected the rendered page %v, got %v", tt.expected, rendered)
+				}
+			}
+
+			if last := labels[len(labels)-1]; last != fmt.Sprint(tt.expected[0].Args[0], "/3") {
+				t.Fatalf("expected the label of page %s of 3, got %s", tt.expected[0].Args[0], last)
+			}
+		})
+	}
+}
+
+func TestInlinePagination_SelectsItem(t *testing.T) {
+	var (
+		selectedID   string
+		selectedPage int
+	)
+
+	codec := &recordingCodec{CallbackDataCodec: telejoon.NewDefaultCallbackDataCodec()}
+
+	pagination := telejoon.NewInlinePagination("list", newPaginationProvider(12), func(
+		client *tgbotapi.TelegramBot,
+		update *telejoon.StateUpdate,
+		id string,
+		page int,
+	) (telejoon.SwitchAction, error) {
+
+		selectedID, selectedPage = id, page
+
+		return nil, nil
+	})
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithCallbackDataCodec(codec).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+		AddInlineMenu("list", pagination.InlineMenu(telejoon.NewStaticText("")))
+
+	// the item of a page that isn't built for the update is still routed
+	engine.Process(nil, callbackQueryUpdate(t, codec, telejoon.CallbackData{
+		Menu:   "list",
+		Action: "item",
+		Args:   []string{"2", "id-11"},
+	}))
+
+	if selectedID != "id-11" || selectedPage != 2 {
+		t.Fatalf("expected id-11 on page 2, got %q on page %d", selectedID, selectedPage)
+	}
+}
+
+func TestInlinePagination_Formation(t *testing.T) {
+	tests := []struct {
+		name       string
+		pagination *telejoon.InlinePagination
+		expected   []int
+	}{
+		{
+			name:       "single page",
+			pagination: telejoon.NewInlinePagination("list", newPaginationProvider(3), nil),
+			expected:   []int{1, 1, 1},
+		},
+		{
+			name: "item formation and navigation",
+			pagination: telejoon.NewInlinePagination("list", newPaginationProvider(10), nil).
+				SetPageSize(7).
+				SetMaxItemsPerRow(3).
+				SetItemFormation(2),
+			expected: []int{2, 3, 2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formation := telejoon.PaginationFormation(tt.pagination)
+
+			if !reflect.DeepEqual(formation, tt.expected) {
+				t.Fatalf("expected formation %v, got %v", tt.expected, formation)
+			}
+		})
+	}
+}
+
+func TestStateUpdate_WithoutStorage(t *testing.T) {
+	update := &telejoon.StateUpdate{}
+
+	if value := update.Get("key"); value != nil {
+		t.Fatalf("expected no value, got %v", value)
+	}
+
+	update.Set("key", "value")
+
+	if value := update.Get("key"); value != "value" {
+		t.Fatalf("expected value, got %v", value)
+	}
+}
@@ -2,7 +2,33 @@ package telejoon
 
 import "github.com/aliforever/go-telegram-bot-api"
 
+// Processor processes the updates it can process, third party processors can implement it to take part in a Router.
 type Processor interface {
-	canProcess(update tgbotapi.Update) bool
+	CanProcess(update tgbotapi.Update) bool
 	Process(client *tgbotapi.TelegramBot, update tgbotapi.Update)
 }
+
+type processorFunc struct {
+	canProcess func(update tgbotapi.Update) bool
+	process    func(client *tgbotapi.TelegramBot, update tgbotapi.Update)
+}
+
+// NewProcessorFunc creates a Processor from a match and a process function.
+func NewProcessorFunc(
+	canProcess func(update tgbotapi.Update) bool,
+	process func(client *tgbotapi.TelegramBot, update tgbotapi.Update),
+) Processor {
+
+	return processorFunc{
+		canProcess: canProcess,
+		process:    process,
+	}
+}
+
+func (p processorFunc) CanProcess(update tgbotapi.Update) bool {
+	return p.canProcess(update)
+}
+
+func (p processorFunc) Process(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	p.process(client, update)
+}
@@ -0,0 +1,102 @@
+package telejoon
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+type route struct {
+	processor Processor
+	priority  int
+}
+
+// Router is a Processor that dispatches each update to the first processor that can process it.
+// Processors with a higher priority are checked first, processors with the same priority are checked in the order
+// they're added. Fallbacks are checked in order when none of the processors can process the update.
+type Router struct {
+	lock sync.RWMutex
+
+	routes []route
+
+	fallbacks []Processor
+}
+
+// NewRouter creates a new Router.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// AddProcessor adds a processor with the given priority.
+func (r *Router) AddProcessor(processor Processor, priority int) *Router {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.routes = append(r.routes, route{
+		processor: processor,
+		priority:  priority,
+	})
+
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return r.routes[i].priority > r.routes[j].priority
+	})
+
+	return r
+}
+
+// AddFallback adds a processor that is used when none of the processors can process the update.
+func (r *Router) AddFallback(processor Processor) *Router {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.fallbacks = append(r.fallbacks, processor)
+
+	return r
+}
+
+// Match returns the processor that should process the update or nil if there's none.
+func (r *Router) Match(update tgbotapi.Update) Processor {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, rt := range r.routes {
+		if rt.processor.CanProcess(update) {
+			return rt.processor
+		}
+	}
+
+	for _, fallback := range r.fallbacks {
+		if fallback.CanProcess(update) {
+			return fallback
+		}
+	}
+
+	return nil
+}
+
+// CanProcess reports whether any of the processors or fallbacks can process the update.
+func (r *Router) CanProcess(update tgbotapi.Update) bool {
+	return r.Match(update) != nil
+}
+
+// Process passes the update to the matched processor.
+func (r *Router) Process(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	r.ProcessContext(context.Background(), client, update)
+}
+
+// ProcessContext passes the update to the matched processor, along with ctx if it's a ContextProcessor.
+func (r *Router) ProcessContext(ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	processor := r.Match(update)
+	if processor == nil {
+		return
+	}
+
+	if p, ok := processor.(ContextProcessor); ok {
+		p.ProcessContext(ctx, client, update)
+		return
+	}
+
+	processor.Process(client, update)
+}
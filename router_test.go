@@ -0,0 +1,98 @@
+package telejoon_test
+
+import (
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+// namedProcessor returns a processor that appends its name to processed for the updates matched by canProcess.
+func namedProcessor(processed *[]string, name string, canProcess func(update tgbotapi.Update) bool) telejoon.Processor {
+	return telejoon.NewProcessorFunc(canProcess, func(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+		*processed = append(*processed, name)
+	})
+}
+
+func TestRouter(t *testing.T) {
+	var processed []string
+
+	isMessage := func(update tgbotapi.Update) bool {
+		return update.Message != nil
+	}
+
+	isCallbackQuery := func(update tgbotapi.Update) bool {
+		return update.CallbackQuery != nil
+	}
+
+	anyUpdate := func(update tgbotapi.Update) bool {
+		return true
+	}
+
+	router := telejoon.NewRouter().
+		AddProcessor(namedProcessor(&processed, "low", isMessage), 0).
+		AddFallback(namedProcessor(&processed, "fallback callback query", isCallbackQuery)).
+		AddFallback(namedProcessor(&processed, "fallback", anyUpdate)).
+		AddProcessor(namedProcessor(&processed, "high", isMessage), 10).
+		AddProcessor(namedProcessor(&processed, "high second", isMessage), 10)
+
+	tests := []struct {
+		name     string
+		update   tgbotapi.Update
+		expected string
+	}{
+		{
+			name:     "higher priority first",
+			update:   tgbotapi.Update{Message: &structs.Message{Text: "hello"}},
+			expected: "high",
+		},
+		{
+			name:     "fallbacks in order",
+			update:   tgbotapi.Update{CallbackQuery: &structs.CallbackQuery{}},
+			expected: "fallback callback query",
+		},
+		{
+			name:     "last fallback",
+			update:   tgbotapi.Update{ChannelPost: &structs.Message{}},
+			expected: "fallback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed = nil
+
+			if !router.CanProcess(tt.update) {
+				t.Fatal("expected the router to process the update")
+			}
+
+			router.Process(nil, tt.update)
+
+			if len(processed) != 1 || processed[0] != tt.expected {
+				t.Fatalf("expected only %s to process the update, got %v", tt.expected, processed)
+			}
+		})
+	}
+}
+
+func TestRouter_NoMatch(t *testing.T) {
+	var processed []string
+
+	router := telejoon.NewRouter().
+		AddProcessor(namedProcessor(&processed, "message", func(update tgbotapi.Update) bool {
+			return update.Message != nil
+		}), 0)
+
+	update := tgbotapi.Update{ChannelPost: &structs.Message{}}
+
+	if router.CanProcess(update) || router.Match(update) != nil {
+		t.Fatal("expected no processor to match the update")
+	}
+
+	router.Process(nil, update)
+
+	if len(processed) != 0 {
+		t.Fatalf("expected the update not to be processed, got %v", processed)
+	}
+}
@@ -0,0 +1,104 @@
+package telejoon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var SessionNotEnabledErr = errors.New("session_not_enabled")
+
+// SessionRepository stores the encoded session of users, keyed the same way as their states.
+// userID is 0 when the state is kept per chat.
+type SessionRepository interface {
+	// LoadSession returns the encoded session, or nil if there's none.
+	LoadSession(ctx context.Context, chatID, userID int64) ([]byte, error)
+	SaveSession(ctx context.Context, chatID, userID int64, data []byte) error
+	DeleteSession(ctx context.Context, chatID, userID int64) error
+}
+
+type defaultSessionRepository struct {
+	sessions sync.Map
+}
+
+// NewDefaultSessionRepository Factory function for defaultSessionRepository.
+func NewDefaultSessionRepository() SessionRepository {
+	return &defaultSessionRepository{
+		sessions: sync.Map{},
+	}
+}
+
+func (s *defaultSessionRepository) LoadSession(_ context.Context, chatID, userID int64) ([]byte, error) {
+	if data, ok := s.sessions.Load(fmt.Sprintf("%d:%d", chatID, userID)); ok {
+		return data.([]byte), nil
+	}
+
+	return nil, nil
+}
+
+func (s *defaultSessionRepository) SaveSession(_ context.Context, chatID, userID int64, data []byte) error {
+	s.sessions.Store(fmt.Sprintf("%d:%d", chatID, userID), data)
+	return nil
+}
+
+func (s *defaultSessionRepository) DeleteSession(_ context.Context, chatID, userID int64) error {
+	s.sessions.Delete(fmt.Sprintf("%d:%d", chatID, userID))
+	return nil
+}
+
+// session is the session of a StateUpdate, it's decoded on the first access and saved after the update is processed.
+type session struct {
+	lock sync.Mutex
+
+	data  []byte
+	value interface{}
+
+	deleted bool
+}
+
+// Session returns the session of the update decoded as T, the returned value is saved after the update is processed.
+// It returns SessionNotEnabledErr if the engine doesn't have a SessionRepository.
+func Session[T any](update *StateUpdate) (*T, error) {
+	s := update.session
+	if s == nil {
+		return nil, SessionNotEnabledErr
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if value, ok := s.value.(*T); ok {
+		return value, nil
+	}
+
+	value := new(T)
+
+	if len(s.data) > 0 && !s.deleted {
+		if err := json.Unmarshal(s.data, value); err != nil {
+			return nil, fmt.Errorf("error_decoding_session: %w", err)
+		}
+	}
+
+	s.value = value
+	s.deleted = false
+
+	return value, nil
+}
+
+// ClearSession deletes the session of the update after the update is processed.
+func ClearSession(update *StateUpdate) error {
+	s := update.session
+	if s == nil {
+		return SessionNotEnabledErr
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.value = nil
+	s.deleted = true
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package telejoon_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telejoon"
+)
+
+type counterSession struct {
+	Count int
+}
+
+func TestSession(t *testing.T) {
+	var (
+		counts []int
+		errs   []error
+	)
+
+	repo := telejoon.NewDefaultSessionRepository()
+
+	// the menus have no text, so nothing is sent to the chat
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithSessions(repo).
+		AddGlobalCommand("/count", func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+			telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			session, err := telejoon.Session[counterSession](update)
+			if err != nil {
+				errs = append(errs, err)
+				return nil, false
+			}
+
+			session.Count++
+			counts = append(counts, session.Count)
+
+			return nil, false
+		}).
+		AddGlobalCommand("/reset", func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+			telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			if err := telejoon.ClearSession(update); err != nil {
+				errs = append(errs, err)
+			}
+
+			return nil, false
+		}).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	for _, text := range []string{"/count", "/count", "/reset", "/count"} {
+		engine.Process(nil, privateTextUpdate(text))
+	}
+
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if len(counts) != 3 || counts[0] != 1 || counts[1] != 2 || counts[2] != 1 {
+		t.Fatalf("expected the counts 1, 2 then 1 after the reset, got %v", counts)
+	}
+
+	data, err := repo.LoadSession(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"Count":1}` {
+		t.Fatalf("expected the saved session, got %s", data)
+	}
+}
+
+func TestSession_NotEnabled(t *testing.T) {
+	var err error
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		AddGlobalCommand("/count", func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+			telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			_, err = telejoon.Session[counterSession](update)
+
+			return nil, false
+		}).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	engine.Process(nil, privateTextUpdate("/count"))
+
+	if !errors.Is(err, telejoon.SessionNotEnabledErr) {
+		t.Fatalf("expected SessionNotEnabledErr, got %v", err)
+	}
+}
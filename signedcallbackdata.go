@@ -0,0 +1,154 @@
+package telejoon
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+const (
+	signedCallbackDataSeparator = "#"
+
+	// callbackSignatureLength is the number of bytes kept of the HMAC, to fit the limit of the callback data.
+	callbackSignatureLength = 8
+)
+
+const defaultCallbackRejectionAlert = "This button is no longer valid."
+
+var CallbackDataInvalidSignatureErr = errors.New("callback_data_invalid_signature")
+
+// SignedCallbackDataCodec is a CallbackDataCodec that signs the data encoded by another codec with an HMAC and the
+// time it's encoded at. Data with an invalid signature, or older than the expiry, isn't decoded.
+type SignedCallbackDataCodec struct {
+	lock sync.Mutex
+
+	codec  CallbackDataCodec
+	secret []byte
+	expiry time.Duration
+	clock  Clock
+}
+
+// NewSignedCallbackDataCodec creates a new SignedCallbackDataCodec, expiry 0 means the data doesn't expire.
+// Wrap it with NewStoreCallbackDataCodec to keep the long data in a store.
+func NewSignedCallbackDataCodec(
+	codec CallbackDataCodec, secret []byte, expiry time.Duration) *SignedCallbackDataCodec {
+
+	return &SignedCallbackDataCodec{
+		codec:  codec,
+		secret: secret,
+		expiry: expiry,
+		clock:  NewSystemClock(),
+	}
+}
+
+// WithClock sets the clock used to check the expiry.
+func (s *SignedCallbackDataCodec) WithClock(clock Clock) *SignedCallbackDataCodec {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clock = clock
+
+	return s
+}
+
+func (s *SignedCallbackDataCodec) registerMenu(name string) error {
+	if registrar, ok := s.codec.(callbackMenuRegistrar); ok {
+		return registrar.registerMenu(name)
+	}
+
+	return nil
+}
+
+func (s *SignedCallbackDataCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureLength])
+}
+
+// Encode encodes the data as "<data>#<timestamp>#<signature>".
+func (s *SignedCallbackDataCodec) Encode(ctx context.Context, data CallbackData) (string, error) {
+	encoded, err := s.codec.Encode(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	now := s.clock.Now()
+	s.lock.Unlock()
+
+	payload := encoded + signedCallbackDataSeparator + strconv.FormatInt(now.Unix(), 36)
+
+	signed := payload + signedCallbackDataSeparator + s.sign(payload)
+	if len(signed) > maxCallbackDataLength {
+		return "", fmt.Errorf("%w: %s", CallbackDataTooLongErr, signed)
+	}
+
+	return signed, nil
+}
+
+// Decode verifies the signature and the expiry and decodes the data, it returns CallbackDataInvalidSignatureErr or
+// CallbackDataExpiredErr if the data is rejected.
+func (s *SignedCallbackDataCodec) Decode(ctx context.Context, data string) (CallbackData, error) {
+	index := strings.LastIndex(data, signedCallbackDataSeparator)
+	if index < 0 {
+		return CallbackData{}, fmt.Errorf("%w: %s", CallbackDataInvalidSignatureErr, data)
+	}
+
+	payload, signature := data[:index], data[index+1:]
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return CallbackData{}, fmt.Errorf("%w: %s", CallbackDataInvalidSignatureErr, data)
+	}
+
+	index = strings.LastIndex(payload, signedCallbackDataSeparator)
+	if index < 0 {
+		return CallbackData{}, fmt.Errorf("%w: %s", CallbackDataInvalidSignatureErr, data)
+	}
+
+	encoded := payload[:index]
+
+	timestamp, err := strconv.ParseInt(payload[index+1:], 36, 64)
+	if err != nil {
+		return CallbackData{}, fmt.Errorf("%w: %s", CallbackDataInvalidSignatureErr, data)
+	}
+
+	s.lock.Lock()
+	now := s.clock.Now()
+	s.lock.Unlock()
+
+	if s.expiry > 0 && now.Sub(time.Unix(timestamp, 0)) > s.expiry {
+		return CallbackData{}, fmt.Errorf("%w: %s", CallbackDataExpiredErr, data)
+	}
+
+	return s.codec.Decode(ctx, encoded)
+}
+
+// isRejectedCallbackData reports whether the callback data is rejected for its signature or expiry.
+func isRejectedCallbackData(err error) bool {
+	return errors.Is(err, CallbackDataInvalidSignatureErr) || errors.Is(err, CallbackDataExpiredErr)
+}
+
+// answerRejectedCallbackQuery shows the alert for the rejected callback query.
+func answerRejectedCallbackQuery(client *tgbotapi.TelegramBot, update *StateUpdate, alert TextBuilder) error {
+	cfg := client.AnswerCallbackQuery().SetCallbackQueryId(update.Update.CallbackQuery.Id)
+
+	if alert != nil {
+		if text := alert.String(update); text != "" {
+			cfg = cfg.SetText(text).SetShowAlert(true)
+		}
+	}
+
+	_, err := client.Send(cfg)
+
+	return err
+}
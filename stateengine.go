@@ -0,0 +1,1223 @@
+package telejoon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+// stateStore loads and stores the state of a StateUpdate.
+type stateStore interface {
+	getState(update *StateUpdate) (string, error)
+	setState(update *StateUpdate, state string) error
+	key(update *StateUpdate) (int64, int64)
+}
+
+// stateEngine holds the menus, handlers and processing logic shared between the state based engines.
+type stateEngine struct {
+	engine
+
+	store stateStore
+
+	m sync.Mutex
+
+	panicHandler PanicHandler
+
+	middlewares []UpdateHandler
+
+	defaultStateName string
+
+	staticMenus map[string]*StaticMenu
+
+	inlineMenus map[string]*InlineMenu
+
+	// inlineMenuNames are the names of the inline menus in the order they're added, the codecs that resolve collisions
+	// between the menus depend on it.
+	inlineMenuNames []string
+
+	// inlineMenuErrs keeps the errors of the inline menus rejected by the callback data codec.
+	inlineMenuErrs map[string]error
+
+	callbackQueryHandlers map[string]func(
+		client *tgbotapi.TelegramBot, update *StateUpdate, args ...string) (SwitchAction, error)
+
+	globalCommands map[string]UpdateHandler
+
+	deepLinks *DeepLinks
+
+	stateHistory         StateHistoryRepository
+	maxStateHistoryDepth int
+	clearHistoryStates   map[string]bool
+
+	sessionRepository SessionRepository
+
+	transitionListeners []TransitionHandler
+
+	stateActivity    StateActivityRepository
+	clock            Clock
+	timeoutScheduler StateTimeoutScheduler
+
+	// expiries are the pending expiries by the chat and user, see scheduleExpiry.
+	expiriesLock sync.Mutex
+	expiries     map[[2]int64]time.Time
+
+	mediaGroupBuffer MediaGroupBuffer
+
+	callbackDataCodec      CallbackDataCodec
+	callbackRejectionAlert TextBuilder
+
+	languageConfig *LanguageConfig
+
+	keys *keyLocks
+}
+
+func newStateEngine(store stateStore, defaultState string, opts ...*Options) stateEngine {
+	return stateEngine{
+		engine: engine{
+			opts: opts,
+		},
+		store:                  store,
+		keys:                   newKeyLocks(),
+		expiries:               map[[2]int64]time.Time{},
+		defaultStateName:       defaultState,
+		staticMenus:            map[string]*StaticMenu{},
+		inlineMenus:            map[string]*InlineMenu{},
+		inlineMenuErrs:         map[string]error{},
+		globalCommands:         map[string]UpdateHandler{},
+		mediaGroupBuffer:       NewDefaultMediaGroupBuffer(),
+		callbackDataCodec:      NewDefaultCallbackDataCodec(),
+		callbackRejectionAlert: NewStaticText(defaultCallbackRejectionAlert),
+		clearHistoryStates:     map[string]bool{},
+		callbackQueryHandlers: map[string]func(
+			*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error){},
+	}
+}
+
+func (e *stateEngine) addStaticMenu(state string, handler *StaticMenu) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.staticMenus[state] = handler
+}
+
+// addForm adds the static menus of the form's steps.
+func (e *stateEngine) addForm(form *Form) {
+	for state, menu := range form.staticMenus(e.onErr) {
+		e.addStaticMenu(state, menu)
+	}
+}
+
+func (e *stateEngine) setPanicHandler(handler PanicHandler) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.panicHandler = handler
+}
+
+func (e *stateEngine) addMiddleware(middleware UpdateHandler) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.middlewares = append(e.middlewares, middleware)
+}
+
+func (e *stateEngine) addInlineMenu(name string, handler *InlineMenu) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	handler.callbackPrefix = name
+
+	if _, ok := e.inlineMenus[name]; !ok {
+		e.inlineMenuNames = append(e.inlineMenuNames, name)
+	}
+
+	e.inlineMenus[name] = handler
+	e.inlineMenuErrs[name] = registerCallbackMenu(e.callbackDataCodec, name)
+}
+
+func (e *stateEngine) setCallbackDataCodec(codec CallbackDataCodec) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	for _, name := range e.inlineMenuNames {
+		e.inlineMenuErrs[name] = registerCallbackMenu(codec, name)
+	}
+
+	e.callbackDataCodec = codec
+}
+
+// getInlineMenu returns the inline menu, or the error of its registration if the callback data codec rejected it.
+func (e *stateEngine) getInlineMenu(name string) (*InlineMenu, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	menu, ok := e.inlineMenus[name]
+	if !ok {
+		return nil, nil
+	}
+
+	if err := e.inlineMenuErrs[name]; err != nil {
+		return nil, err
+	}
+
+	return menu, nil
+}
+
+func (e *stateEngine) setCallbackRejectionAlert(alert TextBuilder) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.callbackRejectionAlert = alert
+}
+
+func (e *stateEngine) addCallbackQueryHandler(
+	data string,
+	fn func(*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error),
+) {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.callbackQueryHandlers[data] = fn
+}
+
+func (e *stateEngine) addGlobalCommand(command string, handler UpdateHandler) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.globalCommands[strings.TrimPrefix(command, "/")] = handler
+}
+
+func (e *stateEngine) setDeepLinks(deepLinks *DeepLinks) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.deepLinks = deepLinks
+}
+
+func (e *stateEngine) setStateHistory(repo StateHistoryRepository, maxDepth int) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.stateHistory = repo
+	e.maxStateHistoryDepth = maxDepth
+}
+
+func (e *stateEngine) addClearHistoryStates(states ...string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	for _, state := range states {
+		e.clearHistoryStates[state] = true
+	}
+}
+
+func (e *stateEngine) setSessionRepository(repo SessionRepository) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.sessionRepository = repo
+}
+
+// loadSession loads the encoded session of the update, it's decoded when it's accessed.
+func (e *stateEngine) loadSession(su *StateUpdate) error {
+	if e.sessionRepository == nil {
+		return nil
+	}
+
+	chatID, userID := e.store.key(su)
+
+	data, err := e.sessionRepository.LoadSession(su.Context(), chatID, userID)
+	if err != nil {
+		return fmt.Errorf("error_loading_session: %d, %w", su.userID, err)
+	}
+
+	su.session = &session{data: data}
+
+	return nil
+}
+
+// saveSession saves the session of the update if it's accessed or deletes it if it's cleared.
+func (e *stateEngine) saveSession(client *tgbotapi.TelegramBot, su *StateUpdate) {
+	if e.sessionRepository == nil || su.session == nil {
+		return
+	}
+
+	su.session.lock.Lock()
+	defer su.session.lock.Unlock()
+
+	chatID, userID := e.store.key(su)
+
+	if su.session.deleted {
+		if err := e.sessionRepository.DeleteSession(su.Context(), chatID, userID); err != nil {
+			e.onErr(client, su.Update, fmt.Errorf("error_deleting_session: %d, %w", su.userID, err))
+		}
+
+		return
+	}
+
+	if su.session.value == nil {
+		return
+	}
+
+	data, err := json.Marshal(su.session.value)
+	if err != nil {
+		e.onErr(client, su.Update, fmt.Errorf("error_encoding_session: %d, %w", su.userID, err))
+		return
+	}
+
+	if err := e.sessionRepository.SaveSession(su.Context(), chatID, userID, data); err != nil {
+		e.onErr(client, su.Update, fmt.Errorf("error_saving_session: %d, %w", su.userID, err))
+	}
+}
+
+func (e *stateEngine) addTransitionListener(listener TransitionHandler) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.transitionListeners = append(e.transitionListeners, listener)
+}
+
+func (e *stateEngine) setStateTimeouts(repo StateActivityRepository, clock Clock) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if clock == nil {
+		clock = NewSystemClock()
+	}
+
+	e.stateActivity = repo
+	e.clock = clock
+}
+
+func (e *stateEngine) setStateTimeoutScheduler(scheduler StateTimeoutScheduler) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.timeoutScheduler = scheduler
+}
+
+func (e *stateEngine) setMediaGroupBuffer(buffer MediaGroupBuffer) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.mediaGroupBuffer = buffer
+}
+
+// getGlobalCommand returns the handler of a global command by its name
+func (e *stateEngine) getGlobalCommand(command string) UpdateHandler {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.globalCommands[command]
+}
+
+// commandNames returns the names of the global commands and the static commands of the static menus.
+func (e *stateEngine) commandNames() []string {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	var names []string
+
+	seen := map[string]bool{}
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for name := range e.globalCommands {
+		add(name)
+	}
+
+	for _, menu := range e.staticMenus {
+		if builder, ok := menu.actionBuilder.(*ActionBuilder); ok {
+			for _, name := range builder.staticCommandNames() {
+				add(name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// withLanguageConfig sets the language config and registers the change language menu if it's set
+func (e *stateEngine) withLanguageConfig(cfg *LanguageConfig) {
+	e.languageConfig = cfg
+
+	if cfg.changeLanguageState == "" {
+		return
+	}
+
+	text := ""
+
+	for _, lang := range cfg.languages.localizers {
+		txt, _ := lang.Get(fmt.Sprintf("%s.Text", cfg.changeLanguageState))
+		if txt == "" {
+			txt = cfg.changeLanguageState
+		}
+
+		text += fmt.Sprintf("%s\n", txt)
+	}
+
+	deferredActionBuilder := NewDeferredActionBuilder(func(update *StateUpdate) *ActionBuilder {
+		actions := NewStaticActionBuilder()
+
+		for i := range cfg.languages.localizers {
+			lang := cfg.languages.localizers[i]
+
+			btnText, _ := lang.Get(fmt.Sprintf("%s.Button", cfg.changeLanguageState))
+			if btnText == "" {
+				btnText = lang.tag
+			}
+
+			actions.AddRawButton(NewStaticText(btnText))
+		}
+
+		return actions
+	})
+
+	deferredDynamicTextBuilder := NewDynamicHandlerText(func(
+		client *tgbotapi.TelegramBot,
+		update *StateUpdate,
+	) (SwitchAction, ShouldPass) {
+
+		for i := range cfg.languages.localizers {
+			lang := cfg.languages.localizers[i]
+
+			btnText, _ := lang.Get(fmt.Sprintf("%s.Button", cfg.changeLanguageState))
+			if btnText == "" {
+				btnText = lang.tag
+			}
+
+			if update.Update.Message.Text == btnText {
+				err := e.languageConfig.repo.SetUserLanguageContext(update.Context(), update.Update.From().Id, lang.tag)
+				if err != nil {
+					e.engine.onErr(client, update.Update, err)
+					return nil, false
+				}
+
+				update.SetLanguage(&lang)
+
+				return NewSwitchActionState(e.defaultStateName), false
+			}
+		}
+
+		return nil, true
+	})
+
+	menu := NewStaticMenu(
+		NewStaticText(text),
+		deferredActionBuilder,
+		deferredDynamicTextBuilder)
+
+	e.addStaticMenu(cfg.changeLanguageState, menu)
+}
+
+// recoverPanic recovers from a panic and passes it to the panic handler if it's set.
+func (e *stateEngine) recoverPanic(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	if e.panicHandler == nil {
+		return
+	}
+
+	if r := recover(); r != nil {
+		e.panicHandler(client, update, r, string(debug.Stack()))
+	}
+}
+
+// newStateUpdate creates a StateUpdate for the given chat and user.
+func (e *stateEngine) newStateUpdate(
+	ctx context.Context, update tgbotapi.Update, chatID, userID int64) *StateUpdate {
+
+	su := &StateUpdate{
+		ctx:        ctx,
+		storage:    &sync.Map{},
+		Update:     update,
+		IsSwitched: false,
+		chatID:     chatID,
+		userID:     userID,
+		onErr:      e.onErr,
+	}
+
+	if update.Message != nil {
+		if name, _, args, ok := parseCommand(update.Message.Text); ok {
+			su.command, su.commandArgs = name, args
+
+			if name == "start" {
+				su.startPayload = args
+			}
+		}
+	}
+
+	return su
+}
+
+// lockKey locks the chat and user of the update until the returned function is called, see keyLocks.
+func (e *stateEngine) lockKey(su *StateUpdate) func() {
+	chatID, userID := e.store.key(su)
+
+	return e.keys.acquire(chatID, userID)
+}
+
+// switchStateOf switches the state of a user outside of an update. The current state is loaded first, so the
+// transition hooks run and the history is kept like a switch made by an update. It waits for the update of the user
+// being processed, so it deadlocks when called from a handler of the same user.
+func (e *stateEngine) switchStateOf(
+	ctx context.Context, client *tgbotapi.TelegramBot, chatID, userID int64, state string) error {
+
+	su := e.newStateUpdate(ctx, tgbotapi.Update{}, chatID, userID)
+	su.withoutUpdate = true
+
+	unlock := e.lockKey(su)
+	defer unlock()
+
+	currentState, err := e.processUserState(su)
+	if err != nil {
+		return err
+	}
+
+	su.State = currentState
+	su.language, _ = e.userLanguage(ctx, userID)
+
+	if err := e.loadSession(su); err != nil {
+		return err
+	}
+
+	defer e.saveSession(client, su)
+
+	return e.switchState(state, client, su)
+}
+
+// process runs the update through the language config, middlewares, static menus and callback handlers.
+func (e *stateEngine) process(client *tgbotapi.TelegramBot, su *StateUpdate) {
+	update := su.Update
+
+	unlock := e.lockKey(su)
+	defer unlock()
+
+	userState, err := e.processUserState(su)
+	if err != nil {
+		e.onErr(client, update, err)
+		return
+	}
+
+	su.State = userState
+
+	// the session is loaded before anything can switch the state, so the transition hooks can use it
+	if err := e.loadSession(su); err != nil {
+		e.onErr(client, update, err)
+		return
+	}
+
+	defer e.saveSession(client, su)
+
+	var lang *Language
+
+	if e.languageConfig != nil {
+		userLanguage, err := e.languageConfig.repo.GetUserLanguageContext(su.Context(), su.userID)
+		if err != nil {
+			if e.languageConfig.forceChooseLanguage {
+				if update.CallbackQuery != nil {
+					go func() {
+						_, err := client.Send(client.AnswerCallbackQuery().
+							SetCallbackQueryId(update.CallbackQuery.Id).
+							SetShowAlert(false))
+						if err != nil {
+							e.onErr(client, update, err)
+						}
+					}()
+				}
+				if userState != e.languageConfig.changeLanguageState {
+					err = e.switchState(e.languageConfig.changeLanguageState, client, su)
+					if err != nil {
+						e.onErr(client, update, err)
+					}
+					return
+				}
+			} else {
+				e.onErr(client, update, err)
+				return
+			}
+		}
+
+		lang = e.languageConfig.languages.GetByTag(userLanguage)
+	}
+
+	su.language = lang
+
+	if expired, err := e.processStateTimeout(client, su); err != nil || expired {
+		if err != nil {
+			e.onErr(client, update, err)
+		}
+
+		return
+	}
+
+	for _, f := range e.middlewares {
+		switchAction, pass := f.Handle(client, su)
+		if err := e.processSwitchAction(switchAction, su, client); err != nil {
+			e.onErr(client, update, err)
+			return
+		}
+
+		if !pass {
+			return
+		}
+	}
+
+	if su.startPayload != "" && e.deepLinks != nil {
+		if handler, matches := e.deepLinks.getHandler(su.startPayload); handler != nil {
+			su.startPayloadMatches = matches
+
+			switchAction, pass := handler.Handle(client, su)
+			if err := e.processSwitchAction(switchAction, su, client); err != nil {
+				e.onErr(client, update, err)
+				return
+			}
+
+			if !pass {
+				return
+			}
+		}
+	}
+
+	if su.command != "" {
+		if handler := e.getGlobalCommand(su.command); handler != nil {
+			switchAction, pass := handler.Handle(client, su)
+			if err := e.processSwitchAction(switchAction, su, client); err != nil {
+				e.onErr(client, update, err)
+				return
+			}
+
+			if !pass {
+				return
+			}
+		}
+	}
+
+	if update.Message != nil {
+		if handler := e.staticMenus[userState]; handler != nil {
+			e.processStaticHandler(handler, client, su)
+			return
+		}
+	}
+
+	if update.CallbackQuery != nil {
+		e.processCallbackQuery(client, su)
+		return
+	}
+}
+
+// getCallbackQueryHandler returns a callback query Handler by data
+func (e *stateEngine) getCallbackQueryHandler(
+	data string) func(*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error) {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if handler, ok := e.callbackQueryHandlers[data]; ok {
+		return handler
+	}
+
+	return nil
+}
+
+func (e *stateEngine) processCallbackQuery(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+) {
+
+	if update.Update.CallbackQuery.Data == "" {
+		return
+	}
+
+	data, err := e.callbackDataCodec.Decode(update.Context(), update.Update.CallbackQuery.Data)
+	if err != nil {
+		if isRejectedCallbackData(err) {
+			err = answerRejectedCallbackQuery(client, update, e.callbackRejectionAlert)
+		}
+
+		if err != nil {
+			e.onErr(client, update.Update, fmt.Errorf("error_decoding_callback_data: %w", err))
+		}
+
+		return
+	}
+
+	inlineMenu, err := e.getInlineMenu(data.Menu)
+	if err != nil {
+		e.onErr(client, update.Update, err)
+		return
+	}
+
+	if inlineMenu == nil {
+		if callbackHandler := e.getCallbackQueryHandler(data.Menu); callbackHandler != nil {
+			switchAction, err := callbackHandler(client, update, data.handlerArgs()...)
+			if err != nil {
+				e.onErr(client, update.Update, err)
+				return
+			}
+
+			if err := e.processSwitchAction(switchAction, update, client); err != nil {
+				e.onErr(client, update.Update, err)
+			}
+		} else {
+			e.onErr(client, update.Update, errors.New("callback query Handler not found: "+data.Menu))
+		}
+		return
+	} else {
+		if err := e.processInlineCallbackHandler(
+			client, update, inlineMenu, append([]string{data.Action}, data.Args...)); err != nil {
+
+			e.onErr(client, update.Update, fmt.Errorf("error processing inline menu: %w", err))
+		}
+
+		return
+	}
+}
+
+func (e *stateEngine) processStaticHandler(
+	handler *StaticMenu,
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+) {
+
+	chatID := update.chatID
+
+	for _, middleware := range handler.middlewares {
+		if middleware.UpdateHandler == nil {
+			continue
+		}
+
+		switchAction, pass := middleware.Handle(client, update)
+
+		if err := e.processSwitchAction(switchAction, update, client); err != nil {
+			e.onErr(client, update.Update, err)
+			return
+		}
+
+		if !pass {
+			return
+		}
+	}
+
+	actionBuilder := handler.processActionBuilder(update)
+
+	if !update.IsSwitched {
+		if update.Update.Message != nil && update.Update.Message.Text != "" {
+			buttonText := update.Update.Message.Text
+
+			if actionBuilder != nil {
+				if update.command != "" {
+					if commandAction := actionBuilder.getCommandByName(update, update.command); commandAction != nil {
+						if e.processAction(commandAction, client, update) {
+							return
+						}
+					}
+				}
+
+				if buttonAction := actionBuilder.getButtonByButton(
+					update,
+					buttonText,
+				); buttonAction != nil {
+					if e.processAction(buttonAction, client, update) {
+						return
+					}
+				}
+			}
+
+			if handler.dynamicHandlers != nil && handler.dynamicHandlers[TextHandler] != nil {
+				switchAction, pass := handler.dynamicHandlers[TextHandler].Handle(client, update)
+				if err := e.processSwitchAction(switchAction, update, client); err != nil {
+					e.onErr(client, update.Update, err)
+					return
+				}
+
+				if !pass {
+					return
+				}
+			}
+		}
+
+		if handler.dynamicHandlers != nil {
+			targetHandler := getDynamicHandler(handler.dynamicHandlers, update.Update.Message)
+
+			if mediaGroupHandler, ok := targetHandler.(DynamicHandlerMediaGroup); ok &&
+				update.Update.Message.MediaGroupId != "" {
+
+				e.bufferMediaGroup(mediaGroupHandler, client, update)
+				return
+			}
+
+			if targetHandler != nil {
+				switchAction, pass := targetHandler.Handle(client, update)
+
+				if err := e.processSwitchAction(switchAction, update, client); err != nil {
+					e.onErr(client, update.Update, err)
+					return
+				}
+
+				if !pass {
+					return
+				}
+			}
+		}
+	}
+
+	var replyMarkup *structs.ReplyKeyboardMarkup
+
+	if actionBuilder != nil {
+		lang := update.Language()
+
+		replyMarkup = actionBuilder.buildButtons(
+			update,
+			lang != nil && lang.rtl && e.languageConfig != nil && e.languageConfig.reverseButtonOrderInRowForRTL,
+		)
+	}
+
+	if replyText := handler.processReplyText(update); replyText != "" {
+		_, err := client.Send(client.Message().
+			SetText(replyText).
+			SetChatId(chatID).
+			SetReplyMarkup(replyMarkup))
+		if err != nil {
+			e.onErr(client, update.Update,
+				fmt.Errorf("error_sending_message_to_chat: %d, %w", chatID, err))
+			return
+		}
+	}
+}
+
+// processAction runs the action of a button or a command and returns true if the processing should stop.
+func (e *stateEngine) processAction(action Action, client *tgbotapi.TelegramBot, update *StateUpdate) bool {
+	chatID := update.chatID
+
+	var err error
+
+	switch a := action.(type) {
+	case textButton:
+		if _, err = client.
+			Send(client.Message().SetText(a.text.String(update)).SetChatId(chatID)); err != nil {
+			err = fmt.Errorf("error_sending_message_to_chat: %d, %w", chatID, err)
+		}
+	case textCommand:
+		if _, err = client.Send(client.Message().SetText(a.text).SetChatId(chatID)); err != nil {
+			err = fmt.Errorf("error_sending_message_to_chat: %d, %w", chatID, err)
+		}
+	case stateButton:
+		if a.hook != nil {
+			switchAction, pass := a.hook.Handle(client, update)
+			if err = e.processSwitchAction(switchAction, update, client); err != nil {
+				e.onErr(client, update.Update, err)
+				return true
+			}
+
+			if !pass {
+				return true
+			}
+		}
+
+		if err = e.switchState(a.state, client, update); err != nil {
+			err = fmt.Errorf("error_switching_state: %d, %w", chatID, err)
+		}
+	case stateCommand:
+		if err = e.switchState(a.state, client, update); err != nil {
+			err = fmt.Errorf("error_switching_state: %d, %w", chatID, err)
+		}
+	case inlineMenuButton:
+		err = e.processInlineHandler(a.inlineMenu, client, update, false)
+		if err != nil {
+			err = fmt.Errorf("error_switching_inline_menu: %d, %w", chatID, err)
+		}
+	case inlineMenuCommand:
+		err = e.processInlineHandler(a.inlineMenu, client, update, false)
+		if err != nil {
+			err = fmt.Errorf("error_switching_inline_menu: %d, %w", chatID, err)
+		}
+	case backButton:
+		if err = e.switchBack(client, update); err != nil {
+			err = fmt.Errorf("error_switching_state: %d, %w", chatID, err)
+		}
+	case rawButton:
+		// do nothing for raw action, as it is only used to act like a button and may be handled in a
+		// dynamic Handler
+		return false
+	default:
+		err = fmt.Errorf("unknown_action_kind: %+v", action)
+	}
+
+	if err != nil {
+		e.onErr(client, update.Update, err)
+	}
+
+	return true
+}
+
+func (e *stateEngine) processInlineHandler(
+	menuName string, client *tgbotapi.TelegramBot, update *StateUpdate, edit bool) error {
+
+	menu, err := e.getInlineMenu(menuName)
+	if err != nil {
+		return err
+	}
+
+	if menu == nil {
+		return fmt.Errorf("inline_menu_not_found: %s", menuName)
+	}
+
+	chatID := update.chatID
+
+	if middlewares := menu.getMiddlewares(); len(middlewares) > 0 {
+		for _, middleware := range middlewares {
+			switchAction, pass := middleware.Handle(client, update)
+			if err := e.processSwitchAction(switchAction, update, client); err != nil {
+				return err
+			}
+
+			if !pass {
+				return nil
+			}
+		}
+	}
+
+	actionBuilder := menu.processActionBuilder(update)
+	if actionBuilder == nil {
+		return fmt.Errorf("inline_menu_action_builder_not_set: %s", menuName)
+	}
+
+	lang := update.Language()
+
+	markup, err := actionBuilder.buildButtons(
+		update,
+		e.callbackDataCodec,
+		lang != nil && lang.rtl && e.languageConfig != nil && e.languageConfig.reverseButtonOrderInRowForRTL,
+	)
+	if err != nil {
+		return err
+	}
+
+	replyText := menu.processTextBuilder(update)
+	if replyText == "" {
+		return fmt.Errorf("inline_menu_reply_text_not_set: %s", menuName)
+	}
+
+	var cfg tgbotapi.Config
+
+	if edit {
+		cfg = client.EditMessageText().SetText(replyText).
+			SetChatId(chatID).
+			SetMessageId(update.Update.CallbackQuery.Message.MessageId).
+			SetReplyMarkup(markup)
+	} else {
+		cfg = client.Message().
+			SetText(replyText).
+			SetChatId(chatID).
+			SetReplyMarkup(markup)
+	}
+
+	_, err = client.Send(cfg)
+	if err != nil {
+		return fmt.Errorf("error_sending_message_to_chat: %d, %w", chatID, err)
+	}
+
+	return nil
+}
+
+type stateHistoryAction int
+
+const (
+	stateHistoryPush stateHistoryAction = iota
+	stateHistoryKeep
+	stateHistoryClear
+)
+
+func (e *stateEngine) switchState(nextState string, client *tgbotapi.TelegramBot, stateUpdate *StateUpdate) error {
+	return e.moveToState(nextState, stateHistoryPush, client, stateUpdate)
+}
+
+// switchBack switches to the last state of the history, or the default state if the history is empty.
+func (e *stateEngine) switchBack(client *tgbotapi.TelegramBot, stateUpdate *StateUpdate) error {
+	if e.stateHistory == nil {
+		return e.moveToState(e.defaultStateName, stateHistoryKeep, client, stateUpdate)
+	}
+
+	chatID, userID := e.store.key(stateUpdate)
+
+	previousState, err := e.stateHistory.PopState(stateUpdate.Context(), chatID, userID)
+	if err != nil {
+		return fmt.Errorf("error_popping_state_history: %d, %w", stateUpdate.userID, err)
+	}
+
+	if previousState == "" {
+		return e.moveToState(e.defaultStateName, stateHistoryKeep, client, stateUpdate)
+	}
+
+	redirects := stateUpdate.redirects
+
+	switched, err := e.changeState(previousState, stateHistoryKeep, client, stateUpdate)
+	if err != nil || switched || stateUpdate.redirects != redirects {
+		return err
+	}
+
+	// the transition is vetoed, so the state is put back in the history
+	return e.stateHistory.PushState(
+		stateUpdate.Context(), chatID, userID, previousState, e.maxStateHistoryDepth)
+}
+
+// switchHome clears the history and switches to the default state.
+func (e *stateEngine) switchHome(client *tgbotapi.TelegramBot, stateUpdate *StateUpdate) error {
+	return e.moveToState(e.defaultStateName, stateHistoryClear, client, stateUpdate)
+}
+
+// updateStateHistory pushes the current state to the history, or clears it if the next state is set to clear it.
+func (e *stateEngine) updateStateHistory(
+	nextState string, historyAction stateHistoryAction, stateUpdate *StateUpdate) error {
+
+	if e.stateHistory == nil {
+		return nil
+	}
+
+	chatID, userID := e.store.key(stateUpdate)
+
+	if historyAction == stateHistoryClear || e.clearHistoryStates[nextState] {
+		return e.stateHistory.ClearStates(stateUpdate.Context(), chatID, userID)
+	}
+
+	if historyAction == stateHistoryKeep || stateUpdate.State == "" || stateUpdate.State == nextState {
+		return nil
+	}
+
+	return e.stateHistory.PushState(
+		stateUpdate.Context(), chatID, userID, stateUpdate.State, e.maxStateHistoryDepth)
+}
+
+// maxStateRedirects is the number of times a transition can be redirected while processing an update.
+const maxStateRedirects = 10
+
+// processTransitionHooks runs the leave hooks of the current state, the transition listeners and the enter hooks of
+// the next state. It returns false if a hook vetoed or redirected the transition.
+func (e *stateEngine) processTransitionHooks(
+	nextState string,
+	handler *StaticMenu,
+	client *tgbotapi.TelegramBot,
+	stateUpdate *StateUpdate,
+) (bool, error) {
+
+	from := stateUpdate.State
+
+	if from == nextState {
+		return true, nil
+	}
+
+	var hooks []TransitionHandler
+
+	if current := e.staticMenus[from]; current != nil {
+		hooks = append(hooks, current.getOnLeave()...)
+	}
+
+	e.m.Lock()
+	hooks = append(hooks, e.transitionListeners...)
+	e.m.Unlock()
+
+	hooks = append(hooks, handler.getOnEnter()...)
+
+	for _, hook := range hooks {
+		switchAction, pass := hook(client, stateUpdate, from, nextState)
+		if switchAction != nil {
+			stateUpdate.redirects++
+			if stateUpdate.redirects > maxStateRedirects {
+				return false, fmt.Errorf("too_many_state_redirects: %s -> %s", from, nextState)
+			}
+
+			return false, e.processSwitchAction(switchAction, stateUpdate, client)
+		}
+
+		if !pass {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (e *stateEngine) moveToState(
+	nextState string,
+	historyAction stateHistoryAction,
+	client *tgbotapi.TelegramBot,
+	stateUpdate *StateUpdate,
+) error {
+
+	_, err := e.changeState(nextState, historyAction, client, stateUpdate)
+
+	return err
+}
+
+// changeState switches to the next state and returns false if the transition is vetoed or redirected by a hook.
+func (e *stateEngine) changeState(
+	nextState string,
+	historyAction stateHistoryAction,
+	client *tgbotapi.TelegramBot,
+	stateUpdate *StateUpdate,
+) (bool, error) {
+
+	if handler := e.staticMenus[nextState]; handler != nil {
+		if proceed, err := e.processTransitionHooks(nextState, handler, client, stateUpdate); !proceed || err != nil {
+			return false, err
+		}
+
+		if err := e.updateStateHistory(nextState, historyAction, stateUpdate); err != nil {
+			return false, fmt.Errorf("error_updating_state_history: %d, %w", stateUpdate.userID, err)
+		}
+
+		if err := e.store.setState(stateUpdate, nextState); err != nil {
+			return false, fmt.Errorf("error_setting_user_state: %d, %w", stateUpdate.userID, err)
+		}
+
+		stateUpdate.State = nextState
+		stateUpdate.IsSwitched = true
+
+		if err := e.touchState(client, stateUpdate); err != nil {
+			return false, err
+		}
+
+		e.processStaticHandler(handler, client, stateUpdate)
+
+		return true, nil
+	}
+
+	return false, fmt.Errorf("no_handler_for_state: %s", nextState)
+}
+
+func (e *stateEngine) processUserState(update *StateUpdate) (string, error) {
+	if e.defaultStateName == "" {
+		return "", fmt.Errorf("empty_default_state_name")
+	}
+
+	userState, err := e.store.getState(update)
+	if err != nil || userState == "" {
+		userState = e.defaultStateName
+		err = e.store.setState(update, userState)
+		if err != nil {
+			return "", fmt.Errorf("store_user_state: %w", err)
+		}
+	}
+
+	return userState, nil
+}
+
+func (e *stateEngine) userLanguage(ctx context.Context, userID int64) (*Language, error) {
+	var lang *Language
+
+	if e.languageConfig != nil {
+		userLanguage, _ := e.languageConfig.repo.GetUserLanguageContext(ctx, userID)
+		if userLanguage != "" {
+			lang = e.languageConfig.languages.GetByTag(userLanguage)
+		}
+	}
+
+	return lang, nil
+
+}
+
+// getHandlerByAction returns inline menu by action
+func (e *stateEngine) processInlineCallbackHandler(
+	client *tgbotapi.TelegramBot, update *StateUpdate, menu *InlineMenu, data []string) error {
+
+	if middlewares := menu.getMiddlewares(); len(middlewares) > 0 {
+		for _, middleware := range middlewares {
+			switchAction, pass := middleware.Handle(client, update)
+			if err := e.processSwitchAction(switchAction, update, client); err != nil {
+				return err
+			}
+
+			if !pass {
+				return nil
+			}
+		}
+	}
+
+	menuActionBuilder := menu.processActionBuilder(update)
+	if menuActionBuilder == nil {
+		return fmt.Errorf("inline_menu_action_builder_not_set: %s", menu.callbackPrefix)
+	}
+
+	actionHandlers := menuActionBuilder.getByCallbackActionData(update)
+	if actionHandlers == nil {
+		return fmt.Errorf("inline_menu_action_data_not_found: %s", menu.callbackPrefix)
+	}
+
+	if handler, ok := actionHandlers[data[0]]; !ok {
+		return &CallbackPayloadError{
+			Action:  data[0],
+			Payload: joinCallbackData(data[1:]),
+			Err:     CallbackActionNotFoundErr,
+		}
+	} else {
+		switch btn := handler.(type) {
+		case inlineAlertButton:
+			cfg := client.AnswerCallbackQuery().
+				SetCallbackQueryId(update.Update.CallbackQuery.Id).
+				SetText(btn.text).
+				SetShowAlert(btn.showAlert)
+			_, err := client.Send(cfg)
+
+			return err
+		case inlineStateButton:
+			// TODO: Implement Switch With edit Message
+
+			return e.switchState(btn.state, client, update)
+		case inlineInlineMenuButton:
+			return e.processInlineHandler(btn.menu, client, update, btn.edit)
+		case inlineCallbackButton:
+			if btn.handler != nil {
+				switchAction, err := btn.handler(client, update, data[1:]...)
+				if err != nil {
+					return err
+				}
+
+				return e.processSwitchAction(switchAction, update, client)
+			}
+
+			return errors.New("callback query Handler not found")
+		}
+	}
+
+	return errors.New("processor_for_action_not_found")
+}
+
+func (e *stateEngine) processSwitchAction(
+	action SwitchAction,
+	update *StateUpdate,
+	client *tgbotapi.TelegramBot,
+) error {
+
+	if action == nil {
+		return nil
+	}
+
+	switch sa := action.(type) {
+	case *SwitchActionState:
+		return e.switchState(action.target(), client, update)
+	case *SwitchActionInlineMenu:
+		return e.processInlineHandler(action.target(), client, update, sa.edit)
+	case *SwitchActionBack:
+		return e.switchBack(client, update)
+	case *SwitchActionHome:
+		return e.switchHome(client, update)
+	}
+
+	return errors.New("unknown switch action")
+}
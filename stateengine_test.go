@@ -0,0 +1,287 @@
+package telejoon_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestSwitchUserState_RunsTransitionHooks(t *testing.T) {
+	var (
+		hooks []string
+		veto  bool
+	)
+
+	repo := telejoon.NewDefaultUserRepository()
+
+	// the menus have no text, so nothing is sent to the chat
+	engine := telejoon.WithPrivateStateHandlers(repo, "Home").
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil).
+			OnLeave(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+				from, to string,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				hooks = append(hooks, "leave "+from+" -> "+to)
+
+				return nil, telejoon.ShouldPass(!veto)
+			})).
+		AddStaticMenu("Admin", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil).
+			OnEnter(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+				from, to string,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				hooks = append(hooks, "enter "+from+" -> "+to)
+
+				return nil, true
+			}))
+
+	veto = true
+
+	if err := engine.SwitchUserState(nil, 1, "Admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, _ := repo.GetUserState(1); state != "Home" {
+		t.Fatalf("expected the vetoed switch to keep Home, got %q", state)
+	}
+
+	veto = false
+
+	if err := engine.SwitchUserState(nil, 1, "Admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, _ := repo.GetUserState(1); state != "Admin" {
+		t.Fatalf("expected Admin, got %q", state)
+	}
+
+	expected := []string{"leave Home -> Admin", "leave Home -> Admin", "enter Home -> Admin"}
+
+	if len(hooks) != len(expected) {
+		t.Fatalf("expected hooks %v, got %v", expected, hooks)
+	}
+
+	for i := range expected {
+		if hooks[i] != expected[i] {
+			t.Fatalf("expected hooks %v, got %v", expected, hooks)
+		}
+	}
+}
+
+func TestSwitchUserState_PushesStateHistory(t *testing.T) {
+	history := telejoon.NewDefaultStateHistoryRepository()
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithStateHistory(history, 10).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+		AddStaticMenu("Settings", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	if err := engine.SwitchUserState(nil, 1, "Settings"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := history.PopState(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != "Home" {
+		t.Fatalf("expected Home in the history, got %q", state)
+	}
+}
+
+func TestMediaGroupHandler_SavesSession(t *testing.T) {
+	type album struct {
+		Photos int
+	}
+
+	sessions := telejoon.NewDefaultSessionRepository()
+	handled := make(chan int, 1)
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		WithSessions(sessions).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil,
+			telejoon.NewDynamicHandlerMediaGroup(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				value, err := telejoon.Session[album](update)
+				if err != nil {
+					t.Error(err)
+				} else {
+					value.Photos = len(update.MediaGroup())
+				}
+
+				handled <- len(update.MediaGroup())
+
+				return nil, false
+			}, 10*time.Millisecond)))
+
+	for id := int64(1); id <= 2; id++ {
+		engine.Process(nil, tgbotapi.Update{Message: &structs.Message{
+			MessageId:    id,
+			From:         &structs.User{Id: 1},
+			Chat:         &structs.Chat{Id: 1, Type: "private"},
+			MediaGroupId: "album",
+			Photo:        []structs.PhotoSize{{FileId: "photo"}},
+		}})
+	}
+
+	select {
+	case photos := <-handled:
+		if photos != 2 {
+			t.Fatalf("expected 2 photos in the album, got %d", photos)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the album to be handled")
+	}
+
+	// the session is saved once the handler returns and the chat is unlocked
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		data, err := sessions.LoadSession(context.Background(), 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var saved album
+		if len(data) > 0 && json.Unmarshal(data, &saved) == nil && saved.Photos == 2 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the album session to be saved, got %s", data)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSendInlineMenu_UnencodablePayload(t *testing.T) {
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		AddInlineMenu("Items", telejoon.NewInlineMenu(telejoon.NewStaticText("Items"),
+			telejoon.AddTypedCallbackButton(
+				telejoon.NewInlineActionBuilder(),
+				telejoon.NewStaticText("Item"),
+				"item",
+				func(update *telejoon.StateUpdate) chan int {
+					return make(chan int)
+				},
+				func(
+					client *tgbotapi.TelegramBot,
+					update *telejoon.StateUpdate,
+					payload chan int,
+				) (telejoon.SwitchAction, error) {
+
+					return nil, nil
+				},
+			)))
+
+	err := engine.SendInlineMenu(nil, &telejoon.StateUpdate{}, "Items", false)
+
+	var payloadErr *telejoon.CallbackPayloadError
+	if !errors.As(err, &payloadErr) || payloadErr.Action != "item" {
+		t.Fatalf("expected a CallbackPayloadError of item, got %v", err)
+	}
+}
+
+func TestSwitchUserState_WaitsForUpdate(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		events []string
+	)
+
+	record := func(event string) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		events = append(events, event)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil,
+			telejoon.NewDynamicHandlerText(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				record("update started")
+				close(started)
+				<-release
+				record("update finished")
+
+				return nil, false
+			})).
+			OnLeave(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+				from, to string,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				record("leave " + from)
+
+				return nil, true
+			})).
+		AddStaticMenu("Admin", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	processed := make(chan struct{})
+
+	go func() {
+		defer close(processed)
+
+		engine.Process(nil, tgbotapi.Update{Message: &structs.Message{
+			MessageId: 1,
+			From:      &structs.User{Id: 1},
+			Chat:      &structs.Chat{Id: 1, Type: "private"},
+			Text:      "hello",
+		}})
+	}()
+
+	<-started
+
+	switched := make(chan error, 1)
+
+	go func() {
+		switched <- engine.SwitchUserState(nil, 1, "Admin")
+	}()
+
+	select {
+	case err := <-switched:
+		t.Fatalf("expected the switch to wait for the update, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	if err := <-switched; err != nil {
+		t.Fatal(err)
+	}
+
+	<-processed
+
+	expected := []string{"update started", "update finished", "leave Home"}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+}
@@ -0,0 +1,79 @@
+package telejoon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// StateHistoryRepository stores the stack of the previous states of users, keyed the same way as their states.
+// userID is 0 when the state is kept per chat.
+type StateHistoryRepository interface {
+	// PushState pushes the state and drops the oldest states above maxDepth, 0 means no limit.
+	PushState(ctx context.Context, chatID, userID int64, state string, maxDepth int) error
+	// PopState pops the last state, it returns an empty string if the stack is empty.
+	PopState(ctx context.Context, chatID, userID int64) (string, error)
+	ClearStates(ctx context.Context, chatID, userID int64) error
+}
+
+type defaultStateHistoryRepository struct {
+	lock sync.Mutex
+
+	stacks map[string][]string
+}
+
+// NewDefaultStateHistoryRepository Factory function for defaultStateHistoryRepository.
+func NewDefaultStateHistoryRepository() StateHistoryRepository {
+	return &defaultStateHistoryRepository{
+		stacks: map[string][]string{},
+	}
+}
+
+func (h *defaultStateHistoryRepository) PushState(
+	_ context.Context, chatID, userID int64, state string, maxDepth int) error {
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := fmt.Sprintf("%d:%d", chatID, userID)
+
+	stack := append(h.stacks[key], state)
+	if maxDepth > 0 && len(stack) > maxDepth {
+		stack = append([]string(nil), stack[len(stack)-maxDepth:]...)
+	}
+
+	h.stacks[key] = stack
+
+	return nil
+}
+
+func (h *defaultStateHistoryRepository) PopState(_ context.Context, chatID, userID int64) (string, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := fmt.Sprintf("%d:%d", chatID, userID)
+
+	stack := h.stacks[key]
+	if len(stack) == 0 {
+		return "", nil
+	}
+
+	state := stack[len(stack)-1]
+
+	if len(stack) == 1 {
+		delete(h.stacks, key)
+	} else {
+		h.stacks[key] = stack[:len(stack)-1]
+	}
+
+	return state, nil
+}
+
+func (h *defaultStateHistoryRepository) ClearStates(_ context.Context, chatID, userID int64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.stacks, fmt.Sprintf("%d:%d", chatID, userID))
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package telejoon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestDefaultStateHistoryRepository_MaxDepth(t *testing.T) {
+	ctx := context.Background()
+
+	repo := telejoon.NewDefaultStateHistoryRepository()
+
+	for _, state := range []string{"Home", "Settings", "Language", "Profile"} {
+		if err := repo.PushState(ctx, 1, 1, state, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []string{"Profile", "Language", ""} {
+		state, err := repo.PopState(ctx, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if state != expected {
+			t.Fatalf("expected %q, got %q", expected, state)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package telejoon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+// Clock returns the current time, it's used to expire the states.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewSystemClock returns a Clock that uses time.Now.
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+// StateActivityRepository stores the last activity of users in their state, keyed the same way as their states.
+// userID is 0 when the state is kept per chat.
+type StateActivityRepository interface {
+	SetLastActivity(ctx context.Context, chatID, userID int64, at time.Time) error
+	// GetLastActivity returns the zero time if there's no activity.
+	GetLastActivity(ctx context.Context, chatID, userID int64) (time.Time, error)
+}
+
+type defaultStateActivityRepository struct {
+	activities sync.Map
+}
+
+// NewDefaultStateActivityRepository Factory function for defaultStateActivityRepository.
+func NewDefaultStateActivityRepository() StateActivityRepository {
+	return &defaultStateActivityRepository{
+		activities: sync.Map{},
+	}
+}
+
+func (s *defaultStateActivityRepository) SetLastActivity(_ context.Context, chatID, userID int64, at time.Time) error {
+	s.activities.Store(fmt.Sprintf("%d:%d", chatID, userID), at)
+	return nil
+}
+
+func (s *defaultStateActivityRepository) GetLastActivity(_ context.Context, chatID, userID int64) (time.Time, error) {
+	if at, ok := s.activities.Load(fmt.Sprintf("%d:%d", chatID, userID)); ok {
+		return at.(time.Time), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// StateTimeoutScheduler schedules expire to run at the given time, e.g. using time.AfterFunc or a job queue.
+// expire must run asynchronously, after the scheduler returns: it waits for the update of the user being processed,
+// which is the one scheduling it, so calling it from the scheduler deadlocks.
+// One expiry is pending per user, it's scheduled again by expire if the user was active since, and does nothing if
+// the user left the states with a timeout. The hooks and handlers run by an expiry get the zero value as the Update
+// of the StateUpdate, StateUpdate.HasUpdate reports false for them.
+type StateTimeoutScheduler func(at time.Time, expire func())
+
+// processStateTimeout switches the user to the fallback state if the state is expired and returns true if it did,
+// otherwise it records the activity of the user.
+func (e *stateEngine) processStateTimeout(client *tgbotapi.TelegramBot, su *StateUpdate) (bool, error) {
+	if e.stateActivity == nil {
+		return false, nil
+	}
+
+	menu := e.staticMenus[su.State]
+	if menu == nil {
+		return false, nil
+	}
+
+	ttl, fallbackState := menu.getTimeout()
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	expired, err := e.isStateExpired(su, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	if expired {
+		return true, e.moveToState(fallbackState, stateHistoryKeep, client, su)
+	}
+
+	return false, e.touchState(client, su)
+}
+
+// isStateExpired reports whether the last activity of the user is older than ttl.
+func (e *stateEngine) isStateExpired(su *StateUpdate, ttl time.Duration) (bool, error) {
+	chatID, userID := e.store.key(su)
+
+	lastActivity, err := e.stateActivity.GetLastActivity(su.Context(), chatID, userID)
+	if err != nil {
+		return false, fmt.Errorf("error_getting_last_activity: %d, %w", su.userID, err)
+	}
+
+	return !lastActivity.IsZero() && e.clock.Now().Sub(lastActivity) >= ttl, nil
+}
+
+// touchState records the activity of the user in a state with a timeout and schedules its expiry.
+func (e *stateEngine) touchState(client *tgbotapi.TelegramBot, su *StateUpdate) error {
+	if e.stateActivity == nil {
+		return nil
+	}
+
+	menu := e.staticMenus[su.State]
+	if menu == nil {
+		return nil
+	}
+
+	ttl, _ := menu.getTimeout()
+	if ttl <= 0 {
+		return nil
+	}
+
+	chatID, userID := e.store.key(su)
+
+	now := e.clock.Now()
+
+	if err := e.stateActivity.SetLastActivity(su.Context(), chatID, userID, now); err != nil {
+		return fmt.Errorf("error_setting_last_activity: %d, %w", su.userID, err)
+	}
+
+	e.scheduleExpiry(client, su, now.Add(ttl))
+
+	return nil
+}
+
+// scheduleExpiry schedules the expiry of the state of the user at, unless an expiry is already pending by then, so
+// the updates of an active user don't pile up timers in the scheduler.
+func (e *stateEngine) scheduleExpiry(client *tgbotapi.TelegramBot, su *StateUpdate, at time.Time) {
+	if e.timeoutScheduler == nil {
+		return
+	}
+
+	chatID, userID := e.store.key(su)
+	key := [2]int64{chatID, userID}
+
+	e.expiriesLock.Lock()
+
+	if scheduled, ok := e.expiries[key]; ok && !scheduled.After(at) {
+		e.expiriesLock.Unlock()
+		return
+	}
+
+	e.expiries[key] = at
+
+	e.expiriesLock.Unlock()
+
+	chatID, userID, group := su.chatID, su.userID, su.group
+
+	e.timeoutScheduler(at, func() {
+		e.expireState(client, chatID, userID, group, at)
+	})
+}
+
+// expireState switches the user to the fallback state if their state is expired, or schedules the expiry again if
+// they were active since. It runs while the chat and user are locked, so it doesn't race with their updates.
+func (e *stateEngine) expireState(
+	client *tgbotapi.TelegramBot, chatID, userID int64, group *GroupInfo, scheduledAt time.Time) {
+
+	su := e.newStateUpdate(context.Background(), tgbotapi.Update{}, chatID, userID)
+	su.group = group
+	su.withoutUpdate = true
+
+	defer e.recoverPanic(client, su.Update)
+
+	unlock := e.lockKey(su)
+	defer unlock()
+
+	storeChatID, storeUserID := e.store.key(su)
+	key := [2]int64{storeChatID, storeUserID}
+
+	e.expiriesLock.Lock()
+	if scheduled, ok := e.expiries[key]; ok && scheduled.Equal(scheduledAt) {
+		delete(e.expiries, key)
+	}
+	e.expiriesLock.Unlock()
+
+	state, err := e.store.getState(su)
+	if err != nil {
+		e.onErr(client, su.Update, fmt.Errorf("error_getting_user_state: %d, %w", userID, err))
+		return
+	}
+
+	menu := e.staticMenus[state]
+	if menu == nil {
+		return
+	}
+
+	ttl, fallbackState := menu.getTimeout()
+	if ttl <= 0 {
+		return
+	}
+
+	lastActivity, err := e.stateActivity.GetLastActivity(su.Context(), storeChatID, storeUserID)
+	if err != nil {
+		e.onErr(client, su.Update, fmt.Errorf("error_getting_last_activity: %d, %w", userID, err))
+		return
+	}
+
+	if lastActivity.IsZero() {
+		return
+	}
+
+	// an update processed since the expiry was scheduled moves the deadline
+	if deadline := lastActivity.Add(ttl); e.clock.Now().Before(deadline) {
+		e.scheduleExpiry(client, su, deadline)
+		return
+	}
+
+	su.State = state
+	su.language, _ = e.userLanguage(su.Context(), userID)
+
+	if err := e.loadSession(su); err != nil {
+		e.onErr(client, su.Update, err)
+		return
+	}
+
+	defer e.saveSession(client, su)
+
+	if err := e.moveToState(fallbackState, stateHistoryKeep, client, su); err != nil {
+		e.onErr(client, su.Update, err)
+	}
+}
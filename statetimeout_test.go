@@ -0,0 +1,201 @@
+package telejoon_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telejoon"
+)
+
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+type scheduledExpiry struct {
+	at     time.Time
+	expire func()
+}
+
+// fakeScheduler keeps the expiries until they're run by the test.
+type fakeScheduler struct {
+	lock     sync.Mutex
+	expiries []scheduledExpiry
+}
+
+func (s *fakeScheduler) Schedule(at time.Time, expire func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expiries = append(s.expiries, scheduledExpiry{at: at, expire: expire})
+}
+
+// take returns the scheduled expiries and resets them.
+func (s *fakeScheduler) take() []scheduledExpiry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	expiries := s.expiries
+	s.expiries = nil
+
+	return expiries
+}
+
+type timeoutTest struct {
+	t *testing.T
+
+	users     telejoon.UserRepository
+	clock     *fakeClock
+	scheduler *fakeScheduler
+	engine    *telejoon.EngineWithPrivateStateHandlers
+}
+
+// newTimeoutTest returns an engine where "quiz" switches to the Quiz state expiring in a minute to Expired, and
+// "home" switches back to Home.
+func newTimeoutTest(t *testing.T, scheduled bool) *timeoutTest {
+	tt := &timeoutTest{
+		t:     t,
+		users: telejoon.NewDefaultUserRepository(),
+		clock: &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	switchOn := func(text, state string) telejoon.Handler {
+		return telejoon.NewDynamicHandlerText(func(
+			client *tgbotapi.TelegramBot,
+			update *telejoon.StateUpdate,
+		) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			if update.Update.Message.Text == text {
+				return telejoon.NewSwitchActionState(state), false
+			}
+
+			return nil, false
+		})
+	}
+
+	tt.engine = telejoon.WithPrivateStateHandlers(tt.users, "Home").
+		WithStateTimeouts(telejoon.NewDefaultStateActivityRepository(), tt.clock).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil, switchOn("quiz", "Quiz"))).
+		AddStaticMenu("Quiz", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil, switchOn("home", "Home")).
+			WithTimeout(time.Minute, "Expired")).
+		AddStaticMenu("Expired", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	if scheduled {
+		tt.scheduler = &fakeScheduler{}
+		tt.engine.WithStateTimeoutScheduler(tt.scheduler.Schedule)
+	}
+
+	return tt
+}
+
+func (tt *timeoutTest) send(text string) {
+	tt.engine.Process(nil, privateTextUpdate(text))
+}
+
+func (tt *timeoutTest) expectState(state string) {
+	tt.t.Helper()
+
+	if current, _ := tt.users.GetUserState(1); current != state {
+		tt.t.Fatalf("expected state %q, got %q", state, current)
+	}
+}
+
+// expire runs the scheduled expiries, expecting them to be scheduled at the given times.
+func (tt *timeoutTest) expire(at ...time.Duration) {
+	tt.t.Helper()
+
+	expiries := tt.scheduler.take()
+
+	if len(expiries) != len(at) {
+		tt.t.Fatalf("expected %d scheduled expiries, got %d", len(at), len(expiries))
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, expiry := range expiries {
+		if !expiry.at.Equal(start.Add(at[i])) {
+			tt.t.Fatalf("expected the expiry at %s, got %s", at[i], expiry.at.Sub(start))
+		}
+
+		expiry.expire()
+	}
+}
+
+func TestStateTimeout_ExpiresOnNextUpdate(t *testing.T) {
+	tt := newTimeoutTest(t, false)
+
+	tt.send("quiz")
+	tt.expectState("Quiz")
+
+	tt.clock.Advance(30 * time.Second)
+	tt.send("answer")
+	tt.expectState("Quiz")
+
+	tt.clock.Advance(time.Minute)
+
+	// the expired state doesn't handle the update, so "home" isn't switching to Home
+	tt.send("home")
+	tt.expectState("Expired")
+}
+
+func TestStateTimeout_ScheduledExpiry(t *testing.T) {
+	tt := newTimeoutTest(t, true)
+
+	tt.send("quiz")
+	tt.expectState("Quiz")
+
+	tt.clock.Advance(time.Minute)
+	tt.expire(time.Minute)
+	tt.expectState("Expired")
+}
+
+func TestStateTimeout_ActiveUserIsRescheduled(t *testing.T) {
+	tt := newTimeoutTest(t, true)
+
+	tt.send("quiz")
+
+	// the updates of the user don't schedule more expiries while one is pending
+	tt.clock.Advance(30 * time.Second)
+	tt.send("answer")
+	tt.send("answer")
+
+	tt.clock.Advance(30 * time.Second)
+	tt.expire(time.Minute)
+	tt.expectState("Quiz")
+
+	tt.clock.Advance(30 * time.Second)
+	tt.expire(90 * time.Second)
+	tt.expectState("Expired")
+}
+
+func TestStateTimeout_NoExpiryAfterLeaving(t *testing.T) {
+	tt := newTimeoutTest(t, true)
+
+	tt.send("quiz")
+	tt.send("home")
+	tt.expectState("Home")
+
+	tt.clock.Advance(time.Minute)
+	tt.expire(time.Minute)
+	tt.expectState("Home")
+
+	if expiries := tt.scheduler.take(); len(expiries) != 0 {
+		t.Fatalf("expected no more expiries, got %d", len(expiries))
+	}
+}
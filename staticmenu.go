@@ -2,8 +2,10 @@ package telejoon
 
 import (
 	"fmt"
-	"github.com/aliforever/go-telegram-bot-api"
 	"sync"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
 )
 
 // StaticMenu is a Handler that receives predefined handlers and acts accordingly.
@@ -19,6 +21,12 @@ type StaticMenu struct {
 	dynamicHandlers map[string]Handler
 
 	middlewares []Middleware
+
+	onEnter []TransitionHandler
+	onLeave []TransitionHandler
+
+	timeout       time.Duration
+	fallbackState string
 }
 
 type (
@@ -41,6 +49,59 @@ func NewStaticMenu(
 	}
 }
 
+// OnEnter adds a hook that runs when switching to the state, before the state is set.
+func (s *StaticMenu) OnEnter(hook TransitionHandler) *StaticMenu {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onEnter = append(s.onEnter, hook)
+
+	return s
+}
+
+// OnLeave adds a hook that runs when switching from the state to another one, before the state is set.
+func (s *StaticMenu) OnLeave(hook TransitionHandler) *StaticMenu {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onLeave = append(s.onLeave, hook)
+
+	return s
+}
+
+func (s *StaticMenu) getOnEnter() []TransitionHandler {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.onEnter
+}
+
+func (s *StaticMenu) getOnLeave() []TransitionHandler {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.onLeave
+}
+
+// WithTimeout switches the users that are inactive in the state for ttl to the fallback state.
+// The engine should have a StateActivityRepository set using WithStateTimeouts.
+func (s *StaticMenu) WithTimeout(ttl time.Duration, fallbackState string) *StaticMenu {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.timeout = ttl
+	s.fallbackState = fallbackState
+
+	return s
+}
+
+func (s *StaticMenu) getTimeout() (time.Duration, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.timeout, s.fallbackState
+}
+
 // processReplyText with StateUpdate and returns the text to be replied.
 func (s *StaticMenu) processReplyText(update *StateUpdate) string {
 	s.lock.Lock()
@@ -97,6 +158,16 @@ func parseMiddlewaresAndDynamicHandlers(handlers ...Handler) (
 			dynamicHandlers[PollHandler] = h
 		case DynamicHandlerDice:
 			dynamicHandlers[DiceHandler] = h
+		case DynamicHandlerAnimation:
+			dynamicHandlers[AnimationHandler] = h
+		case DynamicHandlerWebAppData:
+			dynamicHandlers[WebAppDataHandler] = h
+		case DynamicHandlerSuccessfulPayment:
+			dynamicHandlers[SuccessfulPaymentHandler] = h
+		case DynamicHandlerStory:
+			dynamicHandlers[StoryHandler] = h
+		case DynamicHandlerMediaGroup:
+			dynamicHandlers[MediaGroupHandler] = h
 		case DynamicHandler:
 			dynamicHandlers[DefaultHandler] = h
 		default:
@@ -37,3 +37,27 @@ func NewSwitchActionInlineMenu(targetInlineMenu string, edit bool) *SwitchAction
 func NewSwitchActionState(targetState string) *SwitchActionState {
 	return &SwitchActionState{targetState: targetState}
 }
+
+// SwitchActionBack switches to the previous state in the state history, or the default state if it's empty.
+type SwitchActionBack struct{}
+
+func (s *SwitchActionBack) target() string {
+	return ""
+}
+
+// SwitchActionHome clears the state history and switches to the default state.
+type SwitchActionHome struct{}
+
+func (s *SwitchActionHome) target() string {
+	return ""
+}
+
+// NewSwitchActionBack creates a new SwitchActionBack
+func NewSwitchActionBack() *SwitchActionBack {
+	return &SwitchActionBack{}
+}
+
+// NewSwitchActionHome creates a new SwitchActionHome
+func NewSwitchActionHome() *SwitchActionHome {
+	return &SwitchActionHome{}
+}
@@ -1,13 +1,18 @@
 package telejoon
 
 import (
+	"context"
+
 	tgbotapi "github.com/aliforever/go-telegram-bot-api"
 )
 
+// Start passes the updates of the client to the processor, keeping the updates of each user in order.
 func Start(client *tgbotapi.TelegramBot, processor Processor) {
-	for update := range client.Updates() {
-		if processor.canProcess(update) {
-			go processor.Process(client, update)
-		}
-	}
+	NewDispatcher(processor).Start(client)
+}
+
+// Run is like Start but stops taking updates when ctx is done, then waits for the in-flight updates and returns
+// DrainTimeoutErr if they don't finish in time.
+func Run(ctx context.Context, client *tgbotapi.TelegramBot, processor Processor) error {
+	return NewDispatcher(processor).Run(ctx, client)
 }
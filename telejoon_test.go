@@ -84,7 +84,7 @@ func TestStart(t *testing.T) {
 						WithPanicHandler(func(client *tgbotapi.TelegramBot, update tgbotapi.Update, err any, stack string) {
 							fmt.Println("Panic Handler", update, "\n", stack)
 						}).
-						AddMiddleware(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, bool) {
+						AddMiddleware(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, telejoon.ShouldPass) {
 							if update.Update.Message.Text == "panic" {
 								panic("Panic Test")
 							}
@@ -98,7 +98,7 @@ func TestStart(t *testing.T) {
 									AddTextButton(telejoon.NewStaticText("Hello"), telejoon.NewStaticText("You said Hello")).
 									AddStateButton(telejoon.NewStaticText("Info State"), "Info").
 									AddInlineMenuButton(telejoon.NewStaticText("Info"), "Info"),
-								telejoon.NewDynamicHandlerText(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, bool) {
+								telejoon.NewDynamicHandlerText(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, telejoon.ShouldPass) {
 									if update.Update.Message.Text == "Hello Bro" {
 										client.Send(client.Message().SetChatId(update.Update.From().Id).
 											SetText("Hello Bro!"))
@@ -112,7 +112,7 @@ func TestStart(t *testing.T) {
 
 									return nil, true
 								}),
-								telejoon.NewMiddleware(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, bool) {
+								telejoon.NewMiddleware(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, telejoon.ShouldPass) {
 									update.Set("name", "Ali")
 
 									return nil, true
@@ -141,7 +141,7 @@ func TestStart(t *testing.T) {
 									AddInlineMenuButtonWithEdit(telejoon.NewStaticText("CustomInline"), telejoon.NewStaticText("CustomInline"), "CustomInline").
 									AddInlineMenuButtonWithEdit(telejoon.NewStaticText("Back"), telejoon.NewStaticText("Info"), "Info"))).
 						AddInlineMenu("CustomInline", CustomInlineMenu()).
-						AddMiddleware(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, bool) {
+						AddMiddleware(func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, telejoon.ShouldPass) {
 							fmt.Println("update inside middleware", update)
 
 							if update.Update.Message != nil {
@@ -0,0 +1,113 @@
+package telejoon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+var CallbackActionNotFoundErr = errors.New("callback_action_not_found")
+
+// CallbackPayloadError is returned when the payload of a typed callback button can't be encoded or decoded, or the
+// action of a callback query isn't found.
+type CallbackPayloadError struct {
+	Action  string
+	Payload string
+	Err     error
+}
+
+func (e *CallbackPayloadError) Error() string {
+	return fmt.Sprintf("invalid_callback_payload: %s, %s", e.Action, e.Err)
+}
+
+func (e *CallbackPayloadError) Unwrap() error {
+	return e.Err
+}
+
+// typedCallbackData is the data of a typed callback button, its payload can fail to encode.
+type typedCallbackData[T any] struct {
+	action  string
+	payload func(update *StateUpdate) T
+}
+
+func (d typedCallbackData[T]) String(update *StateUpdate) string {
+	data, _ := d.build(update)
+
+	return data
+}
+
+// build returns the data of the button, or a CallbackPayloadError if the payload can't be encoded.
+func (d typedCallbackData[T]) build(update *StateUpdate) (string, error) {
+	encoded, err := json.Marshal(d.payload(update))
+	if err != nil {
+		return "", &CallbackPayloadError{Action: d.action, Err: err}
+	}
+
+	return joinCallbackData([]string{d.action, string(encoded)}), nil
+}
+
+// TypedCallbackHandler is a CallbackHandler that receives the decoded payload of the button.
+type TypedCallbackHandler[T any] func(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	payload T,
+) (SwitchAction, error)
+
+// AddTypedCallbackButton adds a callback button to the builder with the payload encoded in its data as JSON.
+// The handler receives the decoded payload, and a CallbackPayloadError is passed to the error handler of the engine
+// when the payload is missing or malformed. A payload that can't be encoded fails the inline menu with a
+// CallbackPayloadError when it's sent.
+func AddTypedCallbackButton[T any](
+	b *InlineActionBuilder,
+	button TextBuilder,
+	action string,
+	payload func(update *StateUpdate) T,
+	handler TypedCallbackHandler[T],
+	opts ...*ButtonOptions,
+) *InlineActionBuilder {
+
+	data := typedCallbackData[T]{
+		action:  action,
+		payload: payload,
+	}
+
+	return b.AddCallbackButton(button, data, func(
+		client *tgbotapi.TelegramBot,
+		update *StateUpdate,
+		args ...string,
+	) (SwitchAction, error) {
+
+		if len(args) != 1 {
+			return nil, &CallbackPayloadError{
+				Action: action,
+				Err:    fmt.Errorf("expected_one_payload_arg: %d", len(args)),
+			}
+		}
+
+		var value T
+
+		decoder := json.NewDecoder(bytes.NewReader([]byte(args[0])))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&value); err != nil {
+			return nil, &CallbackPayloadError{
+				Action:  action,
+				Payload: args[0],
+				Err:     err,
+			}
+		}
+
+		if decoder.More() {
+			return nil, &CallbackPayloadError{
+				Action:  action,
+				Payload: args[0],
+				Err:     errors.New("trailing_payload_data"),
+			}
+		}
+
+		return handler(client, update, value)
+	}, opts...)
+}
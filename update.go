@@ -1,26 +1,78 @@
 package telejoon
 
 import (
-	"github.com/aliforever/go-telegram-bot-api"
+	"context"
 	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
 )
 
 type StateUpdate struct {
+	ctx context.Context
+
 	storage *sync.Map
 
 	State      string
 	language   *Language
 	Update     tgbotapi.Update
 	IsSwitched bool
+
+	chatID int64
+	userID int64
+
+	command     string
+	commandArgs string
+
+	startPayload        string
+	startPayloadMatches []string
+
+	group *GroupInfo
+
+	session *session
+
+	user interface{}
+
+	redirects int
+
+	mediaGroup []*structs.Message
+
+	// withoutUpdate is true when the state is switched outside of a Telegram update, e.g. by a state timeout.
+	withoutUpdate bool
+
+	onErr func(client *tgbotapi.TelegramBot, update tgbotapi.Update, err error)
+}
+
+// Context returns the context of the update.
+func (s *StateUpdate) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+
+	return s.ctx
+}
+
+// SetContext replaces the context of the update, e.g. to attach a tracing span.
+func (s *StateUpdate) SetContext(ctx context.Context) {
+	s.ctx = ctx
 }
 
 // Set sets a value for the context.
 func (s *StateUpdate) Set(key, value interface{}) {
+	// the update may be built outside the engines, e.g. in tests
+	if s.storage == nil {
+		s.storage = &sync.Map{}
+	}
+
 	s.storage.Store(key, value)
 }
 
 // Get gets a value from the context.
 func (s *StateUpdate) Get(key interface{}) interface{} {
+	if s.storage == nil {
+		return nil
+	}
+
 	value, _ := s.storage.Load(key)
 
 	return value
@@ -34,3 +86,40 @@ func (s *StateUpdate) SetLanguage(language *Language) {
 func (s *StateUpdate) Language() *Language {
 	return s.language
 }
+
+// Command returns the name of the command without the leading slash and the bot username, if the message is a
+// command.
+func (s *StateUpdate) Command() string {
+	return s.command
+}
+
+// CommandArgs returns the text after the command.
+func (s *StateUpdate) CommandArgs() string {
+	return s.commandArgs
+}
+
+// StartPayload returns the payload of a "/start <payload>" deep link.
+func (s *StateUpdate) StartPayload() string {
+	return s.startPayload
+}
+
+// StartPayloadMatches returns the submatches of the deep link regex, or the payload and the rest after the prefix.
+func (s *StateUpdate) StartPayloadMatches() []string {
+	return s.startPayloadMatches
+}
+
+// MediaGroup returns the messages of the album in order, it's set for DynamicHandlerMediaGroup handlers.
+func (s *StateUpdate) MediaGroup() []*structs.Message {
+	return s.mediaGroup
+}
+
+// HasUpdate reports whether the StateUpdate is made for a Telegram update. It's false when the state is switched by a
+// state timeout or SwitchUserState and SwitchGroupState, the Update is then the zero value.
+func (s *StateUpdate) HasUpdate() bool {
+	return !s.withoutUpdate
+}
+
+// Group returns the group related information of the update, it's nil outside groups.
+func (s *StateUpdate) Group() *GroupInfo {
+	return s.group
+}
@@ -12,6 +12,14 @@ func (h UpdateHandler) Handle(client *tgbotapi.TelegramBot, update *StateUpdate)
 	return h(client, update)
 }
 
+// TransitionHandler runs when switching from a state to another. It can veto the transition by returning false, or
+// redirect it by returning a SwitchAction.
+type TransitionHandler func(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	from, to string,
+) (SwitchAction, ShouldPass)
+
 type Middleware struct {
 	UpdateHandler
 }
@@ -1,8 +1,10 @@
 package telejoon
 
 import (
-	"github.com/aliforever/go-telegram-bot-api/structs"
+	"context"
 	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api/structs"
 )
 
 type UserRepository interface {
@@ -11,10 +13,88 @@ type UserRepository interface {
 	GetUserState(id int64) (string, error)
 }
 
+// ContextUserRepository is a UserRepository that receives the context of the update.
+type ContextUserRepository interface {
+	UpsertUserContext(ctx context.Context, user *structs.User) error
+	SetUserStateContext(ctx context.Context, id int64, state string) error
+	GetUserStateContext(ctx context.Context, id int64) (string, error)
+}
+
+type userRepositoryAdapter struct {
+	repo UserRepository
+}
+
+// NewContextUserRepository adapts a UserRepository to a ContextUserRepository that ignores the context.
+func NewContextUserRepository(repo UserRepository) ContextUserRepository {
+	return userRepositoryAdapter{repo: repo}
+}
+
+func (u userRepositoryAdapter) UpsertUserContext(_ context.Context, user *structs.User) error {
+	return u.repo.UpsertUser(user)
+}
+
+func (u userRepositoryAdapter) SetUserStateContext(_ context.Context, id int64, state string) error {
+	return u.repo.SetUserState(id, state)
+}
+
+func (u userRepositoryAdapter) GetUserStateContext(_ context.Context, id int64) (string, error) {
+	return u.repo.GetUserState(id)
+}
+
+// UserI is a user model built from the Telegram user, FromTgUser is called on the zero value of T.
 type UserI[T any] interface {
 	FromTgUser(tgUser *structs.User) T
 }
 
+// TypedUserRepository stores the users as T, it is used as a ContextUserRepository through NewTypedUserRepository.
+type TypedUserRepository[T UserI[T]] interface {
+	// UpsertTypedUser stores the user and returns the stored model, that is exposed to the handlers.
+	UpsertTypedUser(ctx context.Context, user T) (T, error)
+	SetUserStateContext(ctx context.Context, id int64, state string) error
+	GetUserStateContext(ctx context.Context, id int64) (string, error)
+}
+
+// userModelRepository is a ContextUserRepository that returns the stored model of the user.
+type userModelRepository interface {
+	upsertUserModel(ctx context.Context, user *structs.User) (interface{}, error)
+}
+
+type typedUserRepositoryAdapter[T UserI[T]] struct {
+	repo TypedUserRepository[T]
+}
+
+// NewTypedUserRepository adapts a TypedUserRepository to a ContextUserRepository.
+func NewTypedUserRepository[T UserI[T]](repo TypedUserRepository[T]) ContextUserRepository {
+	return typedUserRepositoryAdapter[T]{repo: repo}
+}
+
+func (u typedUserRepositoryAdapter[T]) upsertUserModel(ctx context.Context, user *structs.User) (interface{}, error) {
+	var model T
+
+	return u.repo.UpsertTypedUser(ctx, model.FromTgUser(user))
+}
+
+func (u typedUserRepositoryAdapter[T]) UpsertUserContext(ctx context.Context, user *structs.User) error {
+	_, err := u.upsertUserModel(ctx, user)
+
+	return err
+}
+
+func (u typedUserRepositoryAdapter[T]) SetUserStateContext(ctx context.Context, id int64, state string) error {
+	return u.repo.SetUserStateContext(ctx, id, state)
+}
+
+func (u typedUserRepositoryAdapter[T]) GetUserStateContext(ctx context.Context, id int64) (string, error) {
+	return u.repo.GetUserStateContext(ctx, id)
+}
+
+// User returns the user model of the update, it's set when the engine uses a TypedUserRepository of T.
+func User[T any](update *StateUpdate) (T, bool) {
+	user, ok := update.user.(T)
+
+	return user, ok
+}
+
 type defaultUserRepository struct {
 	users  sync.Map
 	states sync.Map
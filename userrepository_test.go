@@ -0,0 +1,119 @@
+package telejoon_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+type appUser struct {
+	ID     int64
+	Name   string
+	Visits int
+}
+
+func (appUser) FromTgUser(tgUser *structs.User) appUser {
+	return appUser{ID: tgUser.Id, Name: tgUser.FirstName}
+}
+
+// appUserRepository counts the visits of the users.
+type appUserRepository struct {
+	lock sync.Mutex
+
+	users  map[int64]appUser
+	states map[int64]string
+}
+
+func (r *appUserRepository) UpsertTypedUser(_ context.Context, user appUser) (appUser, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	user.Visits = r.users[user.ID].Visits + 1
+	r.users[user.ID] = user
+
+	return user, nil
+}
+
+func (r *appUserRepository) SetUserStateContext(_ context.Context, id int64, state string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.states[id] = state
+
+	return nil
+}
+
+func (r *appUserRepository) GetUserStateContext(_ context.Context, id int64) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.states[id], nil
+}
+
+func TestUser(t *testing.T) {
+	var (
+		users []appUser
+		found []bool
+	)
+
+	record := func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+		telejoon.SwitchAction, telejoon.ShouldPass) {
+
+		user, ok := telejoon.User[appUser](update)
+		users, found = append(users, user), append(found, ok)
+
+		_, ok = telejoon.User[*appUser](update)
+		found = append(found, ok)
+
+		return nil, false
+	}
+
+	repo := &appUserRepository{users: map[int64]appUser{}, states: map[int64]string{}}
+
+	// the menu has no text, so nothing is sent to the chat
+	engine := telejoon.WithTypedPrivateStateHandlers[appUser](repo, "Home").
+		AddGlobalCommand("/me", record).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	update := privateTextUpdate("/me")
+	update.Message.From.FirstName = "Ali"
+
+	engine.Process(nil, update)
+	engine.Process(nil, update)
+
+	if len(users) != 2 || users[0] != (appUser{ID: 1, Name: "Ali", Visits: 1}) || users[1].Visits != 2 {
+		t.Fatalf("expected the stored user on each update, got %v", users)
+	}
+
+	if !found[0] || found[1] {
+		t.Fatalf("expected the user only as appUser, got %v", found)
+	}
+
+	if repo.states[1] != "Home" {
+		t.Fatalf("expected the state to be stored in the typed repository, got %q", repo.states[1])
+	}
+}
+
+func TestUser_Untyped(t *testing.T) {
+	var found bool
+
+	engine := telejoon.WithPrivateStateHandlers(telejoon.NewDefaultUserRepository(), "Home").
+		AddGlobalCommand("/me", func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+			telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			_, found = telejoon.User[appUser](update)
+
+			return nil, false
+		}).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	engine.Process(nil, privateTextUpdate("/me"))
+
+	if found {
+		t.Fatal("expected no user model without a typed repository")
+	}
+}
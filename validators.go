@@ -0,0 +1,142 @@
+package telejoon
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+// Validator validates the message of an update.
+type Validator func(update *StateUpdate) bool
+
+var phoneRegex = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// Validate wraps the handler so it only runs when all validators pass. Otherwise errText is replied and the user
+// stays in the current state. Wrap it again to reply different errors for different validators.
+func Validate(handler UpdateHandler, errText TextBuilder, validators ...Validator) UpdateHandler {
+	return func(client *tgbotapi.TelegramBot, update *StateUpdate) (SwitchAction, ShouldPass) {
+		for _, validator := range validators {
+			if validator(update) {
+				continue
+			}
+
+			_, err := client.Send(client.Message().SetText(errText.String(update)).SetChatId(update.chatID))
+			if err != nil && update.onErr != nil {
+				update.onErr(client, update.Update,
+					fmt.Errorf("error_sending_message_to_chat: %d, %w", update.chatID, err))
+			}
+
+			return nil, false
+		}
+
+		return handler(client, update)
+	}
+}
+
+// messageText returns the text or the caption of the message.
+func messageText(update *StateUpdate) string {
+	if update.Update.Message == nil {
+		return ""
+	}
+
+	if update.Update.Message.Text != "" {
+		return update.Update.Message.Text
+	}
+
+	return update.Update.Message.Caption
+}
+
+// ValidateRegex validates that the text matches the regex.
+func ValidateRegex(regex *regexp.Regexp) Validator {
+	return func(update *StateUpdate) bool {
+		return regex.MatchString(messageText(update))
+	}
+}
+
+// ValidateLength validates that the text has between min and max characters, max 0 means no limit.
+func ValidateLength(min, max int) Validator {
+	return func(update *StateUpdate) bool {
+		length := utf8.RuneCountInString(messageText(update))
+
+		return length >= min && (max == 0 || length <= max)
+	}
+}
+
+// ValidateNumber validates that the text is a number between min and max.
+func ValidateNumber(min, max float64) Validator {
+	return func(update *StateUpdate) bool {
+		number, err := strconv.ParseFloat(strings.TrimSpace(messageText(update)), 64)
+
+		return err == nil && number >= min && number <= max
+	}
+}
+
+// ValidateEmail validates that the text is an email address.
+func ValidateEmail() Validator {
+	return func(update *StateUpdate) bool {
+		text := strings.TrimSpace(messageText(update))
+
+		address, err := mail.ParseAddress(text)
+
+		return err == nil && address.Address == text
+	}
+}
+
+// ValidatePhone validates that the text is a phone number or the message is a shared contact.
+func ValidatePhone() Validator {
+	return func(update *StateUpdate) bool {
+		if update.Update.Message != nil && update.Update.Message.Contact != nil {
+			return true
+		}
+
+		phone := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(messageText(update))
+
+		return phoneRegex.MatchString(phone)
+	}
+}
+
+// ValidateDate validates that the text is a date in the layout, e.g. "2006-01-02".
+func ValidateDate(layout string) Validator {
+	return func(update *StateUpdate) bool {
+		_, err := time.Parse(layout, strings.TrimSpace(messageText(update)))
+
+		return err == nil
+	}
+}
+
+// ValidateFileSize validates that the message is a document of at most max bytes.
+func ValidateFileSize(max int64) Validator {
+	return func(update *StateUpdate) bool {
+		if update.Update.Message == nil || update.Update.Message.Document == nil {
+			return false
+		}
+
+		return update.Update.Message.Document.FileSize <= max
+	}
+}
+
+// ValidateMimeType validates that the message is a document of one of the MIME types, e.g. "application/pdf" or
+// "image/*".
+func ValidateMimeType(mimeTypes ...string) Validator {
+	return func(update *StateUpdate) bool {
+		if update.Update.Message == nil || update.Update.Message.Document == nil {
+			return false
+		}
+
+		mimeType := update.Update.Message.Document.MimeType
+
+		for _, t := range mimeTypes {
+			if t == mimeType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(t, "*"))) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
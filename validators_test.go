@@ -0,0 +1,53 @@
+package telejoon_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestValidators(t *testing.T) {
+	text := func(text string) *telejoon.StateUpdate {
+		return &telejoon.StateUpdate{Update: tgbotapi.Update{Message: &structs.Message{Text: text}}}
+	}
+
+	document := func(mimeType string, size int64) *telejoon.StateUpdate {
+		return &telejoon.StateUpdate{Update: tgbotapi.Update{Message: &structs.Message{
+			Document: &structs.Document{MimeType: mimeType, FileSize: size},
+		}}}
+	}
+
+	tests := []struct {
+		name      string
+		validator telejoon.Validator
+		update    *telejoon.StateUpdate
+		expected  bool
+	}{
+		{"regex", telejoon.ValidateRegex(regexp.MustCompile(`^[a-z]+$`)), text("abc"), true},
+		{"regex_mismatch", telejoon.ValidateRegex(regexp.MustCompile(`^[a-z]+$`)), text("abc1"), false},
+		{"length", telejoon.ValidateLength(2, 3), text("سلام"), false},
+		{"length_no_max", telejoon.ValidateLength(2, 0), text("hello"), true},
+		{"number", telejoon.ValidateNumber(1, 10), text(" 7.5 "), true},
+		{"number_out_of_range", telejoon.ValidateNumber(1, 10), text("11"), false},
+		{"email", telejoon.ValidateEmail(), text("john@example.com"), true},
+		{"email_with_name", telejoon.ValidateEmail(), text("John <john@example.com>"), false},
+		{"phone", telejoon.ValidatePhone(), text("+1 (555) 123-4567"), true},
+		{"phone_letters", telejoon.ValidatePhone(), text("call me"), false},
+		{"date", telejoon.ValidateDate("2006-01-02"), text("2024-02-29"), true},
+		{"date_invalid", telejoon.ValidateDate("2006-01-02"), text("2023-02-29"), false},
+		{"file_size", telejoon.ValidateFileSize(1024), document("application/pdf", 2048), false},
+		{"mime_type_wildcard", telejoon.ValidateMimeType("image/*"), document("image/png", 1), true},
+		{"mime_type_text", telejoon.ValidateMimeType("application/pdf"), text("file"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.validator(test.update); result != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package telejoon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+)
+
+const webhookSecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookMaxBodySize caps the body of the webhook requests, an update is far smaller.
+const webhookMaxBodySize = 1 << 20
+
+// WebhookReply is a method call sent to Telegram in the response of a webhook request.
+type WebhookReply struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// NewWebhookReply creates a new WebhookReply.
+func NewWebhookReply(method string, params map[string]interface{}) *WebhookReply {
+	return &WebhookReply{
+		Method: method,
+		Params: params,
+	}
+}
+
+// MarshalJSON encodes the method alongside the params as Telegram expects.
+func (w WebhookReply) MarshalJSON() ([]byte, error) {
+	body := make(map[string]interface{}, len(w.Params)+1)
+
+	for key, value := range w.Params {
+		body[key] = value
+	}
+
+	body["method"] = w.Method
+
+	return json.Marshal(body)
+}
+
+type WebhookReplier func(ctx context.Context, update tgbotapi.Update) *WebhookReply
+
+// WebhookHandler is an http.Handler that receives Telegram webhook requests and passes them to a Processor.
+type WebhookHandler struct {
+	lock sync.Mutex
+
+	client    *tgbotapi.TelegramBot
+	processor Processor
+
+	secretToken string
+
+	dispatcher *Dispatcher
+
+	replier WebhookReplier
+}
+
+// NewWebhookHandler creates a new WebhookHandler, updates are processed before the request is answered.
+func NewWebhookHandler(client *tgbotapi.TelegramBot, processor Processor) *WebhookHandler {
+	return &WebhookHandler{
+		client:    client,
+		processor: processor,
+	}
+}
+
+// WithSecretToken sets the secret token that is set using setWebhook, requests with another token are rejected.
+func (h *WebhookHandler) WithSecretToken(token string) *WebhookHandler {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.secretToken = token
+
+	return h
+}
+
+// WithDispatcher passes the updates to the dispatcher instead of the processor and answers the request without
+// waiting for them to be processed.
+func (h *WebhookHandler) WithDispatcher(dispatcher *Dispatcher) *WebhookHandler {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.dispatcher = dispatcher
+
+	return h
+}
+
+// WithReplier sets the function that returns the method call answered inline for each update.
+func (h *WebhookHandler) WithReplier(replier WebhookReplier) *WebhookHandler {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.replier = replier
+
+	return h
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method_not_allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.lock.Lock()
+	secretToken, dispatcher, replier := h.secretToken, h.dispatcher, h.replier
+	h.lock.Unlock()
+
+	if secretToken != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretTokenHeader)), []byte(secretToken)) != 1 {
+
+		http.Error(w, "invalid_secret_token", http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBodySize)).Decode(&update); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request_too_large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, "invalid_update", http.StatusBadRequest)
+		return
+	}
+
+	if dispatcher != nil {
+		dispatcher.dispatch(r.Context(), h.client, update)
+	} else if h.processor.CanProcess(update) {
+		// the update is processed even if Telegram drops the request, like the dispatched updates
+		if processor, ok := h.processor.(ContextProcessor); ok {
+			processor.ProcessContext(context.WithoutCancel(r.Context()), h.client, update)
+		} else {
+			h.processor.Process(h.client, update)
+		}
+	}
+
+	if replier != nil {
+		if reply := replier(r.Context(), update); reply != nil {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(reply)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,120 @@
+package telejoon_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telejoon"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	var received []tgbotapi.Update
+
+	processor := telejoon.NewProcessorFunc(
+		func(update tgbotapi.Update) bool {
+			return update.Message != nil
+		},
+		func(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+			received = append(received, update)
+		},
+	)
+
+	handler := telejoon.NewWebhookHandler(nil, processor).
+		WithSecretToken("secret").
+		WithReplier(func(ctx context.Context, update tgbotapi.Update) *telejoon.WebhookReply {
+			return telejoon.NewWebhookReply("sendMessage", map[string]interface{}{
+				"chat_id": update.Message.Chat.Id,
+				"text":    "pong",
+			})
+		})
+
+	body := `{"update_id":1,"message":{"message_id":1,"chat":{"id":10,"type":"private"},"text":"ping"}}`
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "wrong method", method: http.MethodGet, token: "secret", body: body, wantStatus: http.StatusMethodNotAllowed},
+		{name: "wrong token", method: http.MethodPost, token: "wrong", body: body, wantStatus: http.StatusUnauthorized},
+		{name: "invalid body", method: http.MethodPost, token: "secret", body: "{", wantStatus: http.StatusBadRequest},
+		{
+			name:       "body too large",
+			method:     http.MethodPost,
+			token:      "secret",
+			body:       `{"update_id":1,"padding":"` + strings.Repeat("a", 1<<20) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{name: "valid update", method: http.MethodPost, token: "secret", body: body, wantStatus: http.StatusOK, wantCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", tt.token)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if len(received) != tt.wantCount {
+				t.Fatalf("expected %d processed updates, got %d", tt.wantCount, len(received))
+			}
+
+			if tt.wantCount == 0 {
+				return
+			}
+
+			var reply map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+				t.Fatal(err)
+			}
+
+			if reply["method"] != "sendMessage" || reply["text"] != "pong" || reply["chat_id"] != float64(10) {
+				t.Fatalf("unexpected reply: %v", reply)
+			}
+		})
+	}
+}
+
+type contextProcessor struct {
+	err error
+}
+
+func (p *contextProcessor) CanProcess(update tgbotapi.Update) bool {
+	return true
+}
+
+func (p *contextProcessor) Process(client *tgbotapi.TelegramBot, update tgbotapi.Update) {}
+
+func (p *contextProcessor) ProcessContext(ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	p.err = ctx.Err()
+}
+
+func TestWebhookHandler_CanceledRequest(t *testing.T) {
+	processor := &contextProcessor{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id":1}`)).WithContext(ctx)
+
+	telejoon.NewWebhookHandler(nil, processor).ServeHTTP(httptest.NewRecorder(), req)
+
+	if processor.err != nil {
+		t.Fatalf("expected the update to be processed without the cancellation of the request, got %v", processor.err)
+	}
+}
@@ -0,0 +1,558 @@
+package telejoon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+// ChannelHandlers routes the posts of a channel to dynamic handlers by their content type.
+type ChannelHandlers struct {
+	lock sync.Mutex
+
+	middlewares []Middleware
+
+	dynamicHandlers map[string]Handler
+
+	editedHandlers map[string]Handler
+}
+
+// NewChannelHandlers creates a new ChannelHandlers with the given middlewares and dynamic handlers for new posts.
+func NewChannelHandlers(middlewaresAndDynamicHandlers ...Handler) *ChannelHandlers {
+	middlewares, handlers := parseMiddlewaresAndDynamicHandlers(middlewaresAndDynamicHandlers...)
+
+	return &ChannelHandlers{
+		middlewares:     middlewares,
+		dynamicHandlers: handlers,
+	}
+}
+
+// WithEditedPostHandlers sets the dynamic handlers for edited posts.
+func (c *ChannelHandlers) WithEditedPostHandlers(dynamicHandlers ...Handler) *ChannelHandlers {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, c.editedHandlers = parseMiddlewaresAndDynamicHandlers(dynamicHandlers...)
+
+	return c
+}
+
+// getHandler returns the handler matching the content of the post.
+func (c *ChannelHandlers) getHandler(post *structs.Message, edited bool) Handler {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	handlers := c.dynamicHandlers
+	if edited {
+		handlers = c.editedHandlers
+	}
+
+	if handlers == nil {
+		return nil
+	}
+
+	if len(messageHandlerNames(post)) == 0 && post.Text != "" && handlers[TextHandler] != nil {
+		return handlers[TextHandler]
+	}
+
+	return getDynamicHandler(handlers, post)
+}
+
+type EngineWithChannelHandlers struct {
+	engine
+
+	m sync.Mutex
+
+	panicHandler PanicHandler
+
+	middlewares []UpdateHandler
+
+	defaultHandlers *ChannelHandlers
+
+	channels map[int64]*ChannelHandlers
+
+	inlineMenus map[string]*InlineMenu
+
+	// inlineMenuNames are the names of the inline menus in the order they're added, the codecs that resolve collisions
+	// between the menus depend on it.
+	inlineMenuNames []string
+
+	// inlineMenuErrs keeps the errors of the inline menus rejected by the callback data codec.
+	inlineMenuErrs map[string]error
+
+	callbackDataCodec      CallbackDataCodec
+	callbackRejectionAlert TextBuilder
+
+	mediaGroupBuffer MediaGroupBuffer
+}
+
+func WithChannelHandlers(opts ...*Options) *EngineWithChannelHandlers {
+	return &EngineWithChannelHandlers{
+		engine: engine{
+			opts: opts,
+		},
+		channels:               map[int64]*ChannelHandlers{},
+		inlineMenus:            map[string]*InlineMenu{},
+		inlineMenuErrs:         map[string]error{},
+		callbackDataCodec:      NewDefaultCallbackDataCodec(),
+		callbackRejectionAlert: NewStaticText(defaultCallbackRejectionAlert),
+		mediaGroupBuffer:       NewDefaultMediaGroupBuffer(),
+	}
+}
+
+// AddChannel adds the handlers of a channel
+func (e *EngineWithChannelHandlers) AddChannel(
+	chatID int64,
+	handlers *ChannelHandlers,
+) *EngineWithChannelHandlers {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.channels[chatID] = handlers
+
+	return e
+}
+
+// WithDefaultChannelHandlers sets the handlers for the channels that are not added using AddChannel.
+func (e *EngineWithChannelHandlers) WithDefaultChannelHandlers(
+	handlers *ChannelHandlers,
+) *EngineWithChannelHandlers {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.defaultHandlers = handlers
+
+	return e
+}
+
+func (e *EngineWithChannelHandlers) WithPanicHandler(
+	handler PanicHandler,
+) *EngineWithChannelHandlers {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.panicHandler = handler
+
+	return e
+}
+
+func (e *EngineWithChannelHandlers) AddMiddleware(
+	middleware UpdateHandler,
+) *EngineWithChannelHandlers {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.middlewares = append(e.middlewares, middleware)
+
+	return e
+}
+
+// AddInlineMenu adds an inline menu that can be attached to posts, a menu rejected by the callback data codec returns
+// the error when used.
+func (e *EngineWithChannelHandlers) AddInlineMenu(
+	name string,
+	handler *InlineMenu,
+) *EngineWithChannelHandlers {
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	handler.callbackPrefix = name
+
+	if _, ok := e.inlineMenus[name]; !ok {
+		e.inlineMenuNames = append(e.inlineMenuNames, name)
+	}
+
+	e.inlineMenus[name] = handler
+	e.inlineMenuErrs[name] = registerCallbackMenu(e.callbackDataCodec, name)
+
+	return e
+}
+
+// WithCallbackDataCodec sets the codec of the callback data of the inline menus, defaults to
+// NewDefaultCallbackDataCodec.
+func (e *EngineWithChannelHandlers) WithCallbackDataCodec(codec CallbackDataCodec) *EngineWithChannelHandlers {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	for _, name := range e.inlineMenuNames {
+		e.inlineMenuErrs[name] = registerCallbackMenu(codec, name)
+	}
+
+	e.callbackDataCodec = codec
+
+	return e
+}
+
+// WithCallbackRejectionAlert sets the alert shown for callback queries with an invalid signature or an expired data,
+// an empty text answers them without an alert.
+func (e *EngineWithChannelHandlers) WithCallbackRejectionAlert(alert TextBuilder) *EngineWithChannelHandlers {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.callbackRejectionAlert = alert
+
+	return e
+}
+
+// WithMediaGroupBuffer sets the buffer of the albums handled by DynamicHandlerMediaGroup, defaults to memory.
+func (e *EngineWithChannelHandlers) WithMediaGroupBuffer(buffer MediaGroupBuffer) *EngineWithChannelHandlers {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.mediaGroupBuffer = buffer
+
+	return e
+}
+
+func (e *EngineWithChannelHandlers) getMediaGroupBuffer() MediaGroupBuffer {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.mediaGroupBuffer
+}
+
+func (e *EngineWithChannelHandlers) getPanicHandler() PanicHandler {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.panicHandler
+}
+
+func (e *EngineWithChannelHandlers) Process(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	e.ProcessContext(context.Background(), client, update)
+}
+
+// ProcessContext processes the update with ctx exposed on the StateUpdate.
+func (e *EngineWithChannelHandlers) ProcessContext(
+	ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+
+	if e.panicHandler != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				e.panicHandler(client, update, r, string(debug.Stack()))
+			}
+		}()
+	}
+
+	chat := update.Chat()
+
+	if chat == nil {
+		j, _ := json.Marshal(update)
+		e.onErr(client, update, fmt.Errorf("update.Chat() is nil: %s", string(j)))
+		return
+	}
+
+	su := &StateUpdate{
+		ctx:     ctx,
+		storage: &sync.Map{},
+		Update:  update,
+		chatID:  chat.Id,
+	}
+
+	if from := update.From(); from != nil {
+		su.userID = from.Id
+	}
+
+	for _, f := range e.middlewares {
+		switchAction, pass := f.Handle(client, su)
+		if err := e.processSwitchAction(switchAction, su, client); err != nil {
+			e.onErr(client, update, err)
+			return
+		}
+
+		if !pass {
+			return
+		}
+	}
+
+	switch {
+	case update.ChannelPost != nil:
+		e.processPost(client, su, update.ChannelPost, false)
+	case update.EditedChannelPost != nil:
+		e.processPost(client, su, update.EditedChannelPost, true)
+	case update.CallbackQuery != nil:
+		if err := e.processCallbackQuery(client, su); err != nil {
+			e.onErr(client, update, err)
+		}
+	}
+}
+
+// SendInlineMenu sends an inline menu to the channel of the update, or attaches it to the post if shouldEdit is true.
+func (e *EngineWithChannelHandlers) SendInlineMenu(
+	client *tgbotapi.TelegramBot, update *StateUpdate, menu string, shouldEdit bool) error {
+
+	return e.processInlineHandler(menu, client, update, shouldEdit)
+}
+
+// CanProcess reports whether the update belongs to the engine.
+func (e *EngineWithChannelHandlers) CanProcess(update tgbotapi.Update) bool {
+	if update.ChannelPost != nil || update.EditedChannelPost != nil {
+		return true
+	}
+
+	if update.CallbackQuery != nil {
+		if chat := update.Chat(); chat != nil && chat.Type == "channel" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getChannelHandlers returns the handlers of a channel or the default handlers.
+func (e *EngineWithChannelHandlers) getChannelHandlers(chatID int64) *ChannelHandlers {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if handlers, ok := e.channels[chatID]; ok {
+		return handlers
+	}
+
+	return e.defaultHandlers
+}
+
+func (e *EngineWithChannelHandlers) processPost(
+	client *tgbotapi.TelegramBot,
+	update *StateUpdate,
+	post *structs.Message,
+	edited bool,
+) {
+
+	handlers := e.getChannelHandlers(update.chatID)
+	if handlers == nil {
+		return
+	}
+
+	for _, middleware := range handlers.middlewares {
+		if middleware.UpdateHandler == nil {
+			continue
+		}
+
+		switchAction, pass := middleware.Handle(client, update)
+		if err := e.processSwitchAction(switchAction, update, client); err != nil {
+			e.onErr(client, update.Update, err)
+			return
+		}
+
+		if !pass {
+			return
+		}
+	}
+
+	if handler := handlers.getHandler(post, edited); handler != nil {
+		if mediaGroupHandler, ok := handler.(DynamicHandlerMediaGroup); ok {
+			// the edits of an album are made to one post at a time
+			if !edited {
+				e.bufferMediaGroup(mediaGroupHandler, client, update, post)
+				return
+			}
+
+			update.mediaGroup = []*structs.Message{post}
+		}
+
+		switchAction, _ := handler.Handle(client, update)
+		if err := e.processSwitchAction(switchAction, update, client); err != nil {
+			e.onErr(client, update.Update, err)
+		}
+	}
+}
+
+// getInlineMenu returns the inline menu, or the error of its registration if the callback data codec rejected it.
+func (e *EngineWithChannelHandlers) getInlineMenu(name string) (*InlineMenu, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	menu, ok := e.inlineMenus[name]
+	if !ok {
+		return nil, nil
+	}
+
+	if err := e.inlineMenuErrs[name]; err != nil {
+		return nil, err
+	}
+
+	return menu, nil
+}
+
+func (e *EngineWithChannelHandlers) processCallbackQuery(client *tgbotapi.TelegramBot, update *StateUpdate) error {
+	if update.Update.CallbackQuery.Data == "" {
+		return nil
+	}
+
+	data, err := e.callbackDataCodec.Decode(update.Context(), update.Update.CallbackQuery.Data)
+	if isRejectedCallbackData(err) {
+		return answerRejectedCallbackQuery(client, update, e.callbackRejectionAlert)
+	} else if err != nil {
+		return fmt.Errorf("error_decoding_callback_data: %w", err)
+	}
+
+	menu, err := e.getInlineMenu(data.Menu)
+	if err != nil {
+		return err
+	}
+
+	if menu == nil {
+		return errors.New("inline_menu_not_found: " + data.Menu)
+	}
+
+	for _, middleware := range menu.getMiddlewares() {
+		switchAction, pass := middleware.Handle(client, update)
+		if err := e.processSwitchAction(switchAction, update, client); err != nil {
+			return err
+		}
+
+		if !pass {
+			return nil
+		}
+	}
+
+	menuActionBuilder := menu.processActionBuilder(update)
+	if menuActionBuilder == nil {
+		return fmt.Errorf("inline_menu_action_builder_not_set: %s", menu.callbackPrefix)
+	}
+
+	handler, ok := menuActionBuilder.getByCallbackActionData(update)[data.Action]
+	if !ok {
+		return &CallbackPayloadError{
+			Action:  data.Action,
+			Payload: joinCallbackData(data.Args),
+			Err:     CallbackActionNotFoundErr,
+		}
+	}
+
+	switch btn := handler.(type) {
+	case inlineAlertButton:
+		_, err := client.Send(client.AnswerCallbackQuery().
+			SetCallbackQueryId(update.Update.CallbackQuery.Id).
+			SetText(btn.text).
+			SetShowAlert(btn.showAlert))
+
+		return err
+	case inlineInlineMenuButton:
+		return e.processInlineHandler(btn.menu, client, update, btn.edit)
+	case inlineCallbackButton:
+		if btn.handler == nil {
+			return errors.New("callback query Handler not found")
+		}
+
+		switchAction, err := btn.handler(client, update, data.Args...)
+		if err != nil {
+			return err
+		}
+
+		return e.processSwitchAction(switchAction, update, client)
+	case inlineStateButton:
+		return fmt.Errorf("states_are_not_supported_in_channels: %s", btn.state)
+	}
+
+	return errors.New("processor_for_action_not_found")
+}
+
+// processInlineHandler sends the inline menu to the channel, when edit is true the menu is attached to the post
+// or the message the callback query belongs to. Menus with an empty text only replace the keyboard of the post.
+func (e *EngineWithChannelHandlers) processInlineHandler(
+	menuName string, client *tgbotapi.TelegramBot, update *StateUpdate, edit bool) error {
+
+	menu, err := e.getInlineMenu(menuName)
+	if err != nil {
+		return err
+	}
+
+	if menu == nil {
+		return fmt.Errorf("inline_menu_not_found: %s", menuName)
+	}
+
+	actionBuilder := menu.processActionBuilder(update)
+	if actionBuilder == nil {
+		return fmt.Errorf("inline_menu_action_builder_not_set: %s", menuName)
+	}
+
+	markup, err := actionBuilder.buildButtons(update, e.callbackDataCodec, false)
+	if err != nil {
+		return err
+	}
+
+	replyText := menu.processTextBuilder(update)
+
+	var cfg tgbotapi.Config
+
+	if edit {
+		message := channelMessage(update.Update)
+		if message == nil {
+			return errors.New("no_message_to_edit")
+		}
+
+		if replyText == "" {
+			cfg = client.EditMessageReplyMarkup().
+				SetChatId(update.chatID).
+				SetMessageId(message.MessageId).
+				SetReplyMarkup(markup)
+		} else {
+			cfg = client.EditMessageText().
+				SetText(replyText).
+				SetChatId(update.chatID).
+				SetMessageId(message.MessageId).
+				SetReplyMarkup(markup)
+		}
+	} else {
+		if replyText == "" {
+			return fmt.Errorf("inline_menu_reply_text_not_set: %s", menuName)
+		}
+
+		cfg = client.Message().
+			SetText(replyText).
+			SetChatId(update.chatID).
+			SetReplyMarkup(markup)
+	}
+
+	if _, err := client.Send(cfg); err != nil {
+		return fmt.Errorf("error_sending_message_to_chat: %d, %w", update.chatID, err)
+	}
+
+	return nil
+}
+
+func (e *EngineWithChannelHandlers) processSwitchAction(
+	action SwitchAction,
+	update *StateUpdate,
+	client *tgbotapi.TelegramBot,
+) error {
+
+	if action == nil {
+		return nil
+	}
+
+	switch sa := action.(type) {
+	case *SwitchActionState:
+		return fmt.Errorf("states_are_not_supported_in_channels: %s", sa.target())
+	case *SwitchActionInlineMenu:
+		return e.processInlineHandler(action.target(), client, update, sa.edit)
+	}
+
+	return errors.New("unknown switch action")
+}
+
+// channelMessage returns the post or the message of the callback query.
+func channelMessage(update tgbotapi.Update) *structs.Message {
+	switch {
+	case update.ChannelPost != nil:
+		return update.ChannelPost
+	case update.EditedChannelPost != nil:
+		return update.EditedChannelPost
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.Message
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package telejoon_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+// channelPost returns a post of channel -100.
+func channelPost(post *structs.Message) tgbotapi.Update {
+	post.Chat = &structs.Chat{Id: -100, Type: "channel"}
+
+	return tgbotapi.Update{ChannelPost: post}
+}
+
+// recordHandler returns a handler that appends name to handled.
+func recordHandler(handled *[]string, name string) telejoon.UpdateHandler {
+	return func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (telejoon.SwitchAction, telejoon.ShouldPass) {
+		*handled = append(*handled, name)
+
+		return nil, false
+	}
+}
+
+func TestChannelHandlers_Routing(t *testing.T) {
+	var handled []string
+
+	engine := telejoon.WithChannelHandlers().
+		AddChannel(-100, telejoon.NewChannelHandlers(
+			telejoon.NewDynamicHandlerText(recordHandler(&handled, "channel text")),
+			telejoon.NewDynamicHandlerPhoto(recordHandler(&handled, "channel photo")),
+		).WithEditedPostHandlers(
+			telejoon.NewDynamicHandlerText(recordHandler(&handled, "channel edited text")),
+		)).
+		WithDefaultChannelHandlers(telejoon.NewChannelHandlers(
+			telejoon.NewDefaultHandler(recordHandler(&handled, "default")),
+		))
+
+	otherChannel := &structs.Chat{Id: -200, Type: "channel"}
+
+	tests := []struct {
+		name     string
+		update   tgbotapi.Update
+		expected []string
+	}{
+		{
+			name:     "text post",
+			update:   channelPost(&structs.Message{Text: "hello"}),
+			expected: []string{"channel text"},
+		},
+		{
+			name:     "photo post",
+			update:   channelPost(&structs.Message{Photo: []structs.PhotoSize{{FileId: "photo"}}}),
+			expected: []string{"channel photo"},
+		},
+		{
+			name: "edited post",
+			update: tgbotapi.Update{EditedChannelPost: &structs.Message{
+				Chat: &structs.Chat{Id: -100, Type: "channel"},
+				Text: "hello",
+			}},
+			expected: []string{"channel edited text"},
+		},
+		{
+			name: "edited post without a handler",
+			update: tgbotapi.Update{EditedChannelPost: &structs.Message{
+				Chat:  &structs.Chat{Id: -100, Type: "channel"},
+				Photo: []structs.PhotoSize{{FileId: "photo"}},
+			}},
+		},
+		{
+			name:     "post of another channel",
+			update:   tgbotapi.Update{ChannelPost: &structs.Message{Chat: otherChannel, Text: "hello"}},
+			expected: []string{"default"},
+		},
+		{
+			name:   "edited post of another channel",
+			update: tgbotapi.Update{EditedChannelPost: &structs.Message{Chat: otherChannel, Text: "hello"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+
+			if !engine.CanProcess(tt.update) {
+				t.Fatal("expected the engine to process the post")
+			}
+
+			engine.Process(nil, tt.update)
+
+			if !reflect.DeepEqual(handled, tt.expected) {
+				t.Fatalf("expected %v to be handled, got %v", tt.expected, handled)
+			}
+		})
+	}
+}
+
+func TestChannelHandlers_CanProcess(t *testing.T) {
+	engine := telejoon.WithChannelHandlers()
+
+	tests := []struct {
+		name     string
+		update   tgbotapi.Update
+		expected bool
+	}{
+		{
+			name: "callback query of a channel post",
+			update: tgbotapi.Update{CallbackQuery: &structs.CallbackQuery{
+				Message: &structs.Message{Chat: &structs.Chat{Id: -100, Type: "channel"}},
+			}},
+			expected: true,
+		},
+		{
+			name: "callback query of a private message",
+			update: tgbotapi.Update{CallbackQuery: &structs.CallbackQuery{
+				Message: &structs.Message{Chat: &structs.Chat{Id: 1, Type: "private"}},
+			}},
+		},
+		{
+			name: "private message",
+			update: tgbotapi.Update{Message: &structs.Message{
+				Chat: &structs.Chat{Id: 1, Type: "private"},
+				Text: "hello",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := engine.CanProcess(tt.update); got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestChannelHandlers_MediaGroup(t *testing.T) {
+	handled := make(chan []*structs.Message, 2)
+
+	engine := telejoon.WithChannelHandlers().
+		WithDefaultChannelHandlers(telejoon.NewChannelHandlers(
+			telejoon.NewDynamicHandlerMediaGroup(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				handled <- update.MediaGroup()
+
+				return nil, false
+			}, 10*time.Millisecond)))
+
+	for _, id := range []int64{2, 1} {
+		engine.Process(nil, channelPost(&structs.Message{
+			MessageId:    id,
+			MediaGroupId: "album",
+			Photo:        []structs.PhotoSize{{FileId: "photo"}},
+		}))
+	}
+
+	select {
+	case posts := <-handled:
+		if len(posts) != 2 || posts[0].MessageId != 1 || posts[1].MessageId != 2 {
+			t.Fatalf("expected the 2 posts of the album in order, got %v", posts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the album to be handled")
+	}
+
+	select {
+	case posts := <-handled:
+		t.Fatalf("expected the album to be handled once, got %v", posts)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
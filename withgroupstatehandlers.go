@@ -0,0 +1,446 @@
+package telejoon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+)
+
+type GroupStateScope int
+
+const (
+	// GroupStateScopeMember keeps a separate state for each member of a group.
+	GroupStateScopeMember GroupStateScope = iota
+	// GroupStateScopeChat keeps one state for the whole group.
+	GroupStateScopeChat
+)
+
+type GroupTrigger int
+
+const (
+	// GroupTriggerAll processes every message sent in the group.
+	GroupTriggerAll GroupTrigger = iota
+	// GroupTriggerAddressed only processes messages that mention the bot, reply to the bot or are commands.
+	GroupTriggerAddressed
+)
+
+// GroupInfo holds the group related information of an update.
+type GroupInfo struct {
+	Chat *structs.Chat
+
+	// Mentioned is true when the message mentions the bot.
+	Mentioned bool
+	// RepliedToBot is true when the message is a reply to a message of the bot.
+	RepliedToBot bool
+	// Command is the name of the command without the leading slash and the bot username.
+	Command string
+	// CommandArgs is the rest of the message after the command.
+	CommandArgs string
+
+	commandBot string
+}
+
+// IsAddressed returns true if the message is meant for the bot.
+func (g *GroupInfo) IsAddressed() bool {
+	return g.Mentioned || g.RepliedToBot || g.Command != ""
+}
+
+type EngineWithGroupStateHandlers struct {
+	stateEngine
+
+	groupRepository ContextGroupStateRepository
+
+	trigger GroupTrigger
+
+	botLock sync.Mutex
+	bot     *structs.User
+}
+
+func WithGroupStateHandlers(
+	groupRepo GroupStateRepository, defaultState string, opts ...*Options) *EngineWithGroupStateHandlers {
+
+	return WithGroupStateHandlersContext(NewContextGroupStateRepository(groupRepo), defaultState, opts...)
+}
+
+// WithGroupStateHandlersContext creates the engine with a context aware group state repository.
+func WithGroupStateHandlersContext(
+	groupRepo ContextGroupStateRepository, defaultState string, opts ...*Options) *EngineWithGroupStateHandlers {
+
+	return &EngineWithGroupStateHandlers{
+		stateEngine: newStateEngine(
+			groupStateStore{repo: groupRepo, scope: GroupStateScopeMember}, defaultState, opts...),
+		groupRepository: groupRepo,
+	}
+}
+
+// WithStateScope sets whether the states are kept per member or per group, defaults to GroupStateScopeMember.
+func (e *EngineWithGroupStateHandlers) WithStateScope(scope GroupStateScope) *EngineWithGroupStateHandlers {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.store = groupStateStore{repo: e.groupRepository, scope: scope}
+
+	return e
+}
+
+// WithTrigger sets which group messages are processed, defaults to GroupTriggerAll.
+func (e *EngineWithGroupStateHandlers) WithTrigger(trigger GroupTrigger) *EngineWithGroupStateHandlers {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.trigger = trigger
+
+	return e
+}
+
+// WithBotUsername sets the username of the bot, if it's not set it will be fetched using getMe.
+func (e *EngineWithGroupStateHandlers) WithBotUsername(username string) *EngineWithGroupStateHandlers {
+	e.botLock.Lock()
+	defer e.botLock.Unlock()
+
+	e.bot = &structs.User{Username: strings.TrimPrefix(username, "@")}
+
+	return e
+}
+
+// AddStaticMenu adds a static state Handler
+func (e *EngineWithGroupStateHandlers) AddStaticMenu(
+	state string,
+	handler *StaticMenu,
+) *EngineWithGroupStateHandlers {
+
+	e.addStaticMenu(state, handler)
+
+	return e
+}
+
+func (e *EngineWithGroupStateHandlers) WithPanicHandler(
+	handler PanicHandler,
+) *EngineWithGroupStateHandlers {
+
+	e.setPanicHandler(handler)
+
+	return e
+}
+
+func (e *EngineWithGroupStateHandlers) AddMiddleware(
+	middleware UpdateHandler,
+) *EngineWithGroupStateHandlers {
+
+	e.addMiddleware(middleware)
+
+	return e
+}
+
+// AddInlineMenu adds an inline state Handler, a menu rejected by the callback data codec returns the error when used.
+func (e *EngineWithGroupStateHandlers) AddInlineMenu(
+	name string,
+	handler *InlineMenu,
+) *EngineWithGroupStateHandlers {
+
+	e.addInlineMenu(name, handler)
+
+	return e
+}
+
+// AddGlobalCommand adds a command that is handled in any state, after the middlewares.
+// The handler should return true to let the update reach the static menu of the current state.
+func (e *EngineWithGroupStateHandlers) AddGlobalCommand(
+	command string,
+	handler UpdateHandler,
+) *EngineWithGroupStateHandlers {
+
+	e.addGlobalCommand(command, handler)
+
+	return e
+}
+
+// AddGlobalStateCommand adds a command that switches to the state in any state.
+func (e *EngineWithGroupStateHandlers) AddGlobalStateCommand(command string, state string) *EngineWithGroupStateHandlers {
+	e.addGlobalCommand(command, func(*tgbotapi.TelegramBot, *StateUpdate) (SwitchAction, ShouldPass) {
+		return NewSwitchActionState(state), false
+	})
+
+	return e
+}
+
+// AddGlobalInlineMenuCommand adds a command that sends the inline menu in any state.
+func (e *EngineWithGroupStateHandlers) AddGlobalInlineMenuCommand(command string, inlineMenu string) *EngineWithGroupStateHandlers {
+	e.addGlobalCommand(command, func(*tgbotapi.TelegramBot, *StateUpdate) (SwitchAction, ShouldPass) {
+		return NewSwitchActionInlineMenu(inlineMenu, false), false
+	})
+
+	return e
+}
+
+// WithDeepLinks routes the "/start <payload>" updates, after the middlewares and before the global commands.
+func (e *EngineWithGroupStateHandlers) WithDeepLinks(deepLinks *DeepLinks) *EngineWithGroupStateHandlers {
+	e.setDeepLinks(deepLinks)
+
+	return e
+}
+
+// WithStateHistory keeps the previous states in the repository to switch back to them, using SwitchActionBack or
+// a BackButton. The oldest states are dropped above maxDepth, 0 means no limit.
+func (e *EngineWithGroupStateHandlers) WithStateHistory(repo StateHistoryRepository, maxDepth int) *EngineWithGroupStateHandlers {
+	e.setStateHistory(repo, maxDepth)
+
+	return e
+}
+
+// ClearStateHistoryOn clears the state history when switching to any of the states.
+func (e *EngineWithGroupStateHandlers) ClearStateHistoryOn(states ...string) *EngineWithGroupStateHandlers {
+	e.addClearHistoryStates(states...)
+
+	return e
+}
+
+// WithSessions keeps the sessions of users in the repository, they're loaded before the middlewares and saved after
+// the handlers. Use Session to access the session of an update.
+func (e *EngineWithGroupStateHandlers) WithSessions(repo SessionRepository) *EngineWithGroupStateHandlers {
+	e.setSessionRepository(repo)
+
+	return e
+}
+
+// AddTransitionListener adds a listener that runs on every state transition, after the OnLeave hooks of the current
+// state and before the OnEnter hooks of the next state.
+func (e *EngineWithGroupStateHandlers) AddTransitionListener(listener TransitionHandler) *EngineWithGroupStateHandlers {
+	e.addTransitionListener(listener)
+
+	return e
+}
+
+// WithStateTimeouts keeps the last activity of users in the repository to expire the states of the static menus with
+// a timeout, the expired users are switched to the fallback state on their next update. clock defaults to the system
+// clock when it's nil.
+func (e *EngineWithGroupStateHandlers) WithStateTimeouts(repo StateActivityRepository, clock Clock) *EngineWithGroupStateHandlers {
+	e.setStateTimeouts(repo, clock)
+
+	return e
+}
+
+// WithStateTimeoutScheduler schedules the expiry of the states to switch the users to the fallback state without
+// waiting for their next update.
+func (e *EngineWithGroupStateHandlers) WithStateTimeoutScheduler(scheduler StateTimeoutScheduler) *EngineWithGroupStateHandlers {
+	e.setStateTimeoutScheduler(scheduler)
+
+	return e
+}
+
+// AddForm adds the static menus of the form's fields and review step.
+func (e *EngineWithGroupStateHandlers) AddForm(form *Form) *EngineWithGroupStateHandlers {
+	e.addForm(form)
+
+	return e
+}
+
+// WithMediaGroupBuffer sets the buffer of the albums handled by DynamicHandlerMediaGroup, defaults to memory.
+func (e *EngineWithGroupStateHandlers) WithMediaGroupBuffer(buffer MediaGroupBuffer) *EngineWithGroupStateHandlers {
+	e.setMediaGroupBuffer(buffer)
+
+	return e
+}
+
+// WithCallbackDataCodec sets the codec of the callback data of the inline menus, defaults to
+// NewDefaultCallbackDataCodec.
+func (e *EngineWithGroupStateHandlers) WithCallbackDataCodec(codec CallbackDataCodec) *EngineWithGroupStateHandlers {
+	e.setCallbackDataCodec(codec)
+
+	return e
+}
+
+// WithCallbackRejectionAlert sets the alert shown for callback queries with an invalid signature or an expired data,
+// an empty text answers them without an alert.
+func (e *EngineWithGroupStateHandlers) WithCallbackRejectionAlert(alert TextBuilder) *EngineWithGroupStateHandlers {
+	e.setCallbackRejectionAlert(alert)
+
+	return e
+}
+
+// CommandNames returns the names of the global commands and the commands of the static menus with static names.
+func (e *EngineWithGroupStateHandlers) CommandNames() []string {
+	return e.commandNames()
+}
+
+// WithLanguageConfig adds a language config to the engine
+func (e *EngineWithGroupStateHandlers) WithLanguageConfig(cfg *LanguageConfig) *EngineWithGroupStateHandlers {
+	e.withLanguageConfig(cfg)
+
+	return e
+}
+
+// AddCallbackQueryHandler adds a callback query Handler
+func (e *EngineWithGroupStateHandlers) AddCallbackQueryHandler(
+	data string,
+	fn func(*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error),
+) *EngineWithGroupStateHandlers {
+
+	e.addCallbackQueryHandler(data, fn)
+
+	return e
+}
+
+func (e *EngineWithGroupStateHandlers) Process(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+	e.ProcessContext(context.Background(), client, update)
+}
+
+// ProcessContext processes the update with ctx exposed on the StateUpdate.
+func (e *EngineWithGroupStateHandlers) ProcessContext(
+	ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update) {
+
+	defer e.recoverPanic(client, update)
+
+	from, chat := update.From(), update.Chat()
+
+	if from == nil || chat == nil {
+		j, _ := json.Marshal(update)
+		e.onErr(client, update, fmt.Errorf("update.From() or update.Chat() is nil: %s", string(j)))
+		return
+	}
+
+	bot, err := e.botUser(client)
+	if err != nil {
+		e.onErr(client, update, err)
+		return
+	}
+
+	group := newGroupInfo(update, chat, bot)
+
+	if update.Message != nil {
+		if group.commandBot != "" && !strings.EqualFold(group.commandBot, bot.Username) {
+			return
+		}
+
+		if e.trigger == GroupTriggerAddressed && !group.IsAddressed() {
+			return
+		}
+	}
+
+	su := e.newStateUpdate(ctx, update, chat.Id, from.Id)
+	su.group = group
+
+	e.process(client, su)
+}
+
+// SwitchGroupState switches the state of a group member, userID is ignored for GroupStateScopeChat.
+// The transition hooks of the states run like in a switch made by an update. It waits for the update of the member
+// being processed, so a handler of the same member should return a SwitchAction instead, calling it from there
+// deadlocks.
+func (e *EngineWithGroupStateHandlers) SwitchGroupState(
+	client *tgbotapi.TelegramBot, chatID, userID int64, state string) error {
+
+	return e.switchStateOf(context.Background(), client, chatID, userID, state)
+}
+
+func (e *EngineWithGroupStateHandlers) SendInlineMenu(
+	client *tgbotapi.TelegramBot, update *StateUpdate, menu string, shouldEdit bool) error {
+
+	return e.processInlineHandler(menu, client, update, shouldEdit)
+}
+
+// CanProcess reports whether the update belongs to the engine.
+func (e *EngineWithGroupStateHandlers) CanProcess(update tgbotapi.Update) bool {
+	if chat := update.Chat(); chat != nil && (chat.Type == "group" || chat.Type == "supergroup") {
+		return true
+	}
+
+	return false
+}
+
+// botUser returns the bot user and fetches it using getMe on the first call.
+func (e *EngineWithGroupStateHandlers) botUser(client *tgbotapi.TelegramBot) (*structs.User, error) {
+	e.botLock.Lock()
+	defer e.botLock.Unlock()
+
+	if e.bot != nil {
+		return e.bot, nil
+	}
+
+	resp, err := client.Send(client.GetMe())
+	if err != nil {
+		return nil, fmt.Errorf("error_getting_bot_user: %w", err)
+	}
+
+	if resp == nil || resp.User == nil {
+		return nil, errors.New("empty_bot_user")
+	}
+
+	e.bot = resp.User
+
+	return e.bot, nil
+}
+
+// newGroupInfo detects the mentions, replies and commands of a group update.
+func newGroupInfo(update tgbotapi.Update, chat *structs.Chat, bot *structs.User) *GroupInfo {
+	info := &GroupInfo{Chat: chat}
+
+	msg := update.Message
+	if msg == nil {
+		return info
+	}
+
+	if reply := msg.ReplyToMessage; reply != nil && reply.From != nil {
+		info.RepliedToBot = (bot.Id != 0 && reply.From.Id == bot.Id) ||
+			(bot.Username != "" && strings.EqualFold(reply.From.Username, bot.Username))
+	}
+
+	if name, botName, args, ok := parseCommand(msg.Text); ok {
+		info.Command, info.commandBot, info.CommandArgs = name, botName, args
+	}
+
+	text := utf16.Encode([]rune(msg.Text))
+
+	for _, entity := range msg.Entities {
+		switch entity.Type {
+		case "mention":
+			if entity.Offset < 0 || entity.Offset+entity.Length > len(text) {
+				continue
+			}
+
+			mention := string(utf16.Decode(text[entity.Offset : entity.Offset+entity.Length]))
+			if bot.Username != "" && strings.EqualFold(mention, "@"+bot.Username) {
+				info.Mentioned = true
+			}
+		case "text_mention":
+			if entity.User != nil && bot.Id != 0 && entity.User.Id == bot.Id {
+				info.Mentioned = true
+			}
+		}
+	}
+
+	return info
+}
+
+// groupStateStore keeps the state of groups in a ContextGroupStateRepository.
+type groupStateStore struct {
+	repo  ContextGroupStateRepository
+	scope GroupStateScope
+}
+
+func (s groupStateStore) key(update *StateUpdate) (int64, int64) {
+	if s.scope == GroupStateScopeChat {
+		return update.chatID, 0
+	}
+
+	return update.chatID, update.userID
+}
+
+func (s groupStateStore) getState(update *StateUpdate) (string, error) {
+	chatID, userID := s.key(update)
+
+	return s.repo.GetGroupStateContext(update.Context(), chatID, userID)
+}
+
+func (s groupStateStore) setState(update *StateUpdate, state string) error {
+	chatID, userID := s.key(update)
+
+	return s.repo.SetGroupStateContext(update.Context(), chatID, userID, state)
+}
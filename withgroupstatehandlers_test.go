@@ -0,0 +1,198 @@
+package telejoon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+// newGroupTestEngine returns a group engine of @MyBot passing the group info of the handled messages to handled.
+func newGroupTestEngine(trigger telejoon.GroupTrigger, handled func(group telejoon.GroupInfo)) *telejoon.EngineWithGroupStateHandlers {
+	return telejoon.WithGroupStateHandlers(telejoon.NewDefaultGroupStateRepository(), "Home").
+		WithBotUsername("@MyBot").
+		WithTrigger(trigger).
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil,
+			telejoon.NewDynamicHandlerText(func(
+				client *tgbotapi.TelegramBot,
+				update *telejoon.StateUpdate,
+			) (telejoon.SwitchAction, telejoon.ShouldPass) {
+
+				handled(*update.Group())
+
+				return nil, false
+			})))
+}
+
+func groupMessage(message *structs.Message) tgbotapi.Update {
+	message.MessageId = 1
+	message.From = &structs.User{Id: 1}
+	message.Chat = &structs.Chat{Id: -1, Type: "supergroup"}
+
+	return tgbotapi.Update{Message: message}
+}
+
+func TestGroupInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  *structs.Message
+		handled  bool
+		expected telejoon.GroupInfo
+	}{
+		{
+			name: "mention",
+			message: &structs.Message{
+				Text:     "hi @mybot",
+				Entities: []structs.MessageEntity{{Type: "mention", Offset: 3, Length: 6}},
+			},
+			handled:  true,
+			expected: telejoon.GroupInfo{Mentioned: true},
+		},
+		{
+			name: "mention after an emoji counted in UTF-16 code units",
+			message: &structs.Message{
+				Text:     "😀 @MyBot",
+				Entities: []structs.MessageEntity{{Type: "mention", Offset: 3, Length: 6}},
+			},
+			handled:  true,
+			expected: telejoon.GroupInfo{Mentioned: true},
+		},
+		{
+			name: "mention of another bot",
+			message: &structs.Message{
+				Text:     "😀 @OtherBot",
+				Entities: []structs.MessageEntity{{Type: "mention", Offset: 3, Length: 9}},
+			},
+			handled: true,
+		},
+		{
+			name: "mention out of the text",
+			message: &structs.Message{
+				Text:     "@MyBot",
+				Entities: []structs.MessageEntity{{Type: "mention", Offset: 1, Length: 6}},
+			},
+			handled: true,
+		},
+		{
+			name: "reply to the bot",
+			message: &structs.Message{
+				Text:           "yes",
+				ReplyToMessage: &structs.Message{From: &structs.User{Id: 2, Username: "MyBot"}},
+			},
+			handled:  true,
+			expected: telejoon.GroupInfo{RepliedToBot: true},
+		},
+		{
+			name: "reply to a member",
+			message: &structs.Message{
+				Text:           "yes",
+				ReplyToMessage: &structs.Message{From: &structs.User{Id: 3, Username: "member"}},
+			},
+			handled: true,
+		},
+		{
+			name:     "command",
+			message:  &structs.Message{Text: "/help topics"},
+			handled:  true,
+			expected: telejoon.GroupInfo{Command: "help", CommandArgs: "topics"},
+		},
+		{
+			name:     "command of the bot",
+			message:  &structs.Message{Text: "/help@mybot topics"},
+			handled:  true,
+			expected: telejoon.GroupInfo{Command: "help", CommandArgs: "topics"},
+		},
+		{
+			name:    "command of another bot",
+			message: &structs.Message{Text: "/help@OtherBot topics"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var groups []telejoon.GroupInfo
+
+			engine := newGroupTestEngine(telejoon.GroupTriggerAll, func(group telejoon.GroupInfo) {
+				groups = append(groups, group)
+			})
+
+			engine.Process(nil, groupMessage(tt.message))
+
+			if !tt.handled {
+				if len(groups) != 0 {
+					t.Fatalf("expected the message to be ignored, got %+v", groups[0])
+				}
+
+				return
+			}
+
+			if len(groups) != 1 {
+				t.Fatalf("expected the message to be handled once, got %d", len(groups))
+			}
+
+			group := groups[0]
+
+			if group.Chat == nil || group.Chat.Id != -1 {
+				t.Fatalf("expected the chat of the group, got %+v", group.Chat)
+			}
+
+			if group.Mentioned != tt.expected.Mentioned ||
+				group.RepliedToBot != tt.expected.RepliedToBot ||
+				group.Command != tt.expected.Command ||
+				group.CommandArgs != tt.expected.CommandArgs {
+
+				t.Fatalf("expected %+v, got %+v", tt.expected, group)
+			}
+		})
+	}
+}
+
+func TestGroupTriggerAddressed(t *testing.T) {
+	var handled []string
+
+	engine := newGroupTestEngine(telejoon.GroupTriggerAddressed, func(group telejoon.GroupInfo) {
+		handled = append(handled, group.Command)
+	})
+
+	engine.Process(nil, groupMessage(&structs.Message{Text: "hello"}))
+	engine.Process(nil, groupMessage(&structs.Message{Text: "/help"}))
+
+	if len(handled) != 1 || handled[0] != "help" {
+		t.Fatalf("expected only the command to be handled, got %v", handled)
+	}
+}
+
+type contextKey string
+
+// contextGroupStateRepository records the values of contextKey("request") it receives.
+type contextGroupStateRepository struct {
+	telejoon.ContextGroupStateRepository
+
+	requests []interface{}
+}
+
+func (r *contextGroupStateRepository) GetGroupStateContext(ctx context.Context, chatID, userID int64) (string, error) {
+	r.requests = append(r.requests, ctx.Value(contextKey("request")))
+
+	return r.ContextGroupStateRepository.GetGroupStateContext(ctx, chatID, userID)
+}
+
+func TestWithGroupStateHandlersContext(t *testing.T) {
+	repo := &contextGroupStateRepository{
+		ContextGroupStateRepository: telejoon.NewContextGroupStateRepository(telejoon.NewDefaultGroupStateRepository()),
+	}
+
+	engine := telejoon.WithGroupStateHandlersContext(repo, "Home").
+		WithBotUsername("MyBot").
+		AddStaticMenu("Home", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+	ctx := context.WithValue(context.Background(), contextKey("request"), "r1")
+
+	engine.ProcessContext(ctx, nil, groupMessage(&structs.Message{Text: "hello"}))
+
+	if len(repo.requests) == 0 || repo.requests[0] != "r1" {
+		t.Fatalf("expected the repository to receive the context of the update, got %v", repo.requests)
+	}
+}
@@ -1,66 +1,50 @@
 package telejoon
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"runtime/debug"
-	"strings"
-	"sync"
 
 	"github.com/aliforever/go-telegram-bot-api"
-	"github.com/aliforever/go-telegram-bot-api/structs"
 )
 
 type EngineWithPrivateStateHandlers struct {
-	engine
+	stateEngine
 
-	userRepository UserRepository
-
-	m sync.Mutex
-
-	panicHandler PanicHandler
-
-	middlewares []UpdateHandler
-
-	defaultStateName string
-
-	staticMenus map[string]*StaticMenu
-
-	inlineMenus map[string]*InlineMenu
-
-	callbackQueryHandlers map[string]func(
-		client *tgbotapi.TelegramBot, update *StateUpdate, args ...string) (SwitchAction, error)
-
-	languageConfig *LanguageConfig
+	userRepository ContextUserRepository
 }
 
 func WithPrivateStateHandlers(
 	userRepo UserRepository, defaultState string, opts ...*Options) *EngineWithPrivateStateHandlers {
 
+	return WithPrivateStateHandlersContext(NewContextUserRepository(userRepo), defaultState, opts...)
+}
+
+// WithPrivateStateHandlersContext creates the engine with a context aware user repository.
+func WithPrivateStateHandlersContext(
+	userRepo ContextUserRepository, defaultState string, opts ...*Options) *EngineWithPrivateStateHandlers {
+
 	return &EngineWithPrivateStateHandlers{
-		engine: engine{
-			opts: opts,
-		},
-		userRepository:   userRepo,
-		defaultStateName: defaultState,
-		staticMenus:      map[string]*StaticMenu{},
-		inlineMenus:      map[string]*InlineMenu{},
-		callbackQueryHandlers: map[string]func(
-			*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error){},
+		stateEngine:    newStateEngine(privateStateStore{repo: userRepo}, defaultState, opts...),
+		userRepository: userRepo,
 	}
 }
 
+// WithTypedPrivateStateHandlers creates the engine with a repository that stores the users as T, the stored user is
+// exposed to the handlers using User[T].
+func WithTypedPrivateStateHandlers[T UserI[T]](
+	userRepo TypedUserRepository[T], defaultState string, opts ...*Options) *EngineWithPrivateStateHandlers {
+
+	return WithPrivateStateHandlersContext(NewTypedUserRepository[T](userRepo), defaultState, opts...)
+}
+
 // AddStaticMenu adds a static state Handler
 func (e *EngineWithPrivateStateHandlers) AddStaticMenu(
 	state string,
 	handler *StaticMenu,
 ) *EngineWithPrivateStateHandlers {
 
-	e.m.Lock()
-	defer e.m.Unlock()
-
-	e.staticMenus[state] = handler
+	e.addStaticMenu(state, handler)
 
 	return e
 }
@@ -69,10 +53,7 @@ func (e *EngineWithPrivateStateHandlers) WithPanicHandler(
 	handler PanicHandler,
 ) *EngineWithPrivateStateHandlers {
 
-	e.m.Lock()
-	defer e.m.Unlock()
-
-	e.panicHandler = handler
+	e.setPanicHandler(handler)
 
 	return e
 }
@@ -81,124 +62,158 @@ func (e *EngineWithPrivateStateHandlers) AddMiddleware(
 	middleware UpdateHandler,
 ) *EngineWithPrivateStateHandlers {
 
-	e.m.Lock()
-	defer e.m.Unlock()
-
-	e.middlewares = append(e.middlewares, middleware)
+	e.addMiddleware(middleware)
 
 	return e
 }
 
-// AddInlineMenu adds an inline state Handler
+// AddInlineMenu adds an inline state Handler, a menu rejected by the callback data codec returns the error when used.
 func (e *EngineWithPrivateStateHandlers) AddInlineMenu(
 	name string,
 	handler *InlineMenu,
 ) *EngineWithPrivateStateHandlers {
 
-	e.m.Lock()
-	defer e.m.Unlock()
+	e.addInlineMenu(name, handler)
 
-	handler.callbackPrefix = name
+	return e
+}
 
-	e.inlineMenus[name] = handler
+// AddGlobalCommand adds a command that is handled in any state, after the middlewares.
+// The handler should return true to let the update reach the static menu of the current state.
+func (e *EngineWithPrivateStateHandlers) AddGlobalCommand(
+	command string,
+	handler UpdateHandler,
+) *EngineWithPrivateStateHandlers {
+
+	e.addGlobalCommand(command, handler)
 
 	return e
 }
 
-// WithLanguageConfig adds a language config to the engine
-func (e *EngineWithPrivateStateHandlers) WithLanguageConfig(cfg *LanguageConfig) *EngineWithPrivateStateHandlers {
-	e.languageConfig = cfg
+// AddGlobalStateCommand adds a command that switches to the state in any state.
+func (e *EngineWithPrivateStateHandlers) AddGlobalStateCommand(command string, state string) *EngineWithPrivateStateHandlers {
+	e.addGlobalCommand(command, func(*tgbotapi.TelegramBot, *StateUpdate) (SwitchAction, ShouldPass) {
+		return NewSwitchActionState(state), false
+	})
 
-	if cfg.changeLanguageState == "" {
-		return e
-	}
+	return e
+}
 
-	text := ""
+// AddGlobalInlineMenuCommand adds a command that sends the inline menu in any state.
+func (e *EngineWithPrivateStateHandlers) AddGlobalInlineMenuCommand(command string, inlineMenu string) *EngineWithPrivateStateHandlers {
+	e.addGlobalCommand(command, func(*tgbotapi.TelegramBot, *StateUpdate) (SwitchAction, ShouldPass) {
+		return NewSwitchActionInlineMenu(inlineMenu, false), false
+	})
 
-	for _, lang := range cfg.languages.localizers {
-		txt, _ := lang.Get(fmt.Sprintf("%s.Text", cfg.changeLanguageState))
-		if txt == "" {
-			txt = cfg.changeLanguageState
-		}
+	return e
+}
 
-		text += fmt.Sprintf("%s\n", txt)
-	}
+// WithDeepLinks routes the "/start <payload>" updates, after the middlewares and before the global commands.
+func (e *EngineWithPrivateStateHandlers) WithDeepLinks(deepLinks *DeepLinks) *EngineWithPrivateStateHandlers {
+	e.setDeepLinks(deepLinks)
 
-	deferredActionBuilder := NewDeferredActionBuilder(func(update *StateUpdate) *ActionBuilder {
-		actions := NewStaticActionBuilder()
+	return e
+}
 
-		for i := range cfg.languages.localizers {
-			lang := cfg.languages.localizers[i]
+// WithStateHistory keeps the previous states in the repository to switch back to them, using SwitchActionBack or
+// a BackButton. The oldest states are dropped above maxDepth, 0 means no limit.
+func (e *EngineWithPrivateStateHandlers) WithStateHistory(repo StateHistoryRepository, maxDepth int) *EngineWithPrivateStateHandlers {
+	e.setStateHistory(repo, maxDepth)
 
-			btnText, _ := lang.Get(fmt.Sprintf("%s.Button", cfg.changeLanguageState))
-			if btnText == "" {
-				btnText = lang.tag
-			}
+	return e
+}
 
-			actions.AddRawButton(NewStaticText(btnText))
-		}
+// ClearStateHistoryOn clears the state history when switching to any of the states.
+func (e *EngineWithPrivateStateHandlers) ClearStateHistoryOn(states ...string) *EngineWithPrivateStateHandlers {
+	e.addClearHistoryStates(states...)
 
-		return actions
-	})
+	return e
+}
 
-	deferredDynamicTextBuilder := NewDynamicHandlerText(func(
-		client *tgbotapi.TelegramBot,
-		update *StateUpdate,
-	) (SwitchAction, ShouldPass) {
+// WithSessions keeps the sessions of users in the repository, they're loaded before the middlewares and saved after
+// the handlers. Use Session to access the session of an update.
+func (e *EngineWithPrivateStateHandlers) WithSessions(repo SessionRepository) *EngineWithPrivateStateHandlers {
+	e.setSessionRepository(repo)
 
-		for i := range cfg.languages.localizers {
-			lang := cfg.languages.localizers[i]
+	return e
+}
 
-			btnText, _ := lang.Get(fmt.Sprintf("%s.Button", cfg.changeLanguageState))
-			if btnText == "" {
-				btnText = lang.tag
-			}
+// AddTransitionListener adds a listener that runs on every state transition, after the OnLeave hooks of the current
+// state and before the OnEnter hooks of the next state.
+func (e *EngineWithPrivateStateHandlers) AddTransitionListener(listener TransitionHandler) *EngineWithPrivateStateHandlers {
+	e.addTransitionListener(listener)
 
-			if update.Update.Message.Text == btnText {
-				err := e.languageConfig.repo.SetUserLanguage(update.Update.From().Id, lang.tag)
-				if err != nil {
-					e.engine.onErr(client, update.Update, err)
-					return nil, false
-				}
+	return e
+}
 
-				update.SetLanguage(&lang)
+// WithStateTimeouts keeps the last activity of users in the repository to expire the states of the static menus with
+// a timeout, the expired users are switched to the fallback state on their next update. clock defaults to the system
+// clock when it's nil.
+func (e *EngineWithPrivateStateHandlers) WithStateTimeouts(repo StateActivityRepository, clock Clock) *EngineWithPrivateStateHandlers {
+	e.setStateTimeouts(repo, clock)
 
-				return NewSwitchActionState(e.defaultStateName), false
-			}
-		}
+	return e
+}
 
-		return nil, true
-	})
+// WithStateTimeoutScheduler schedules the expiry of the states to switch the users to the fallback state without
+// waiting for their next update.
+func (e *EngineWithPrivateStateHandlers) WithStateTimeoutScheduler(scheduler StateTimeoutScheduler) *EngineWithPrivateStateHandlers {
+	e.setStateTimeoutScheduler(scheduler)
+
+	return e
+}
+
+// AddForm adds the static menus of the form's fields and review step.
+func (e *EngineWithPrivateStateHandlers) AddForm(form *Form) *EngineWithPrivateStateHandlers {
+	e.addForm(form)
 
-	menu := NewStaticMenu(
-		NewStaticText(text),
-		deferredActionBuilder,
-		deferredDynamicTextBuilder)
+	return e
+}
+
+// WithMediaGroupBuffer sets the buffer of the albums handled by DynamicHandlerMediaGroup, defaults to memory.
+func (e *EngineWithPrivateStateHandlers) WithMediaGroupBuffer(buffer MediaGroupBuffer) *EngineWithPrivateStateHandlers {
+	e.setMediaGroupBuffer(buffer)
+
+	return e
+}
+
+// WithCallbackDataCodec sets the codec of the callback data of the inline menus, defaults to
+// NewDefaultCallbackDataCodec.
+func (e *EngineWithPrivateStateHandlers) WithCallbackDataCodec(codec CallbackDataCodec) *EngineWithPrivateStateHandlers {
+	e.setCallbackDataCodec(codec)
+
+	return e
+}
+
+// WithCallbackRejectionAlert sets the alert shown for callback queries with an invalid signature or an expired data,
+// an empty text answers them without an alert.
+func (e *EngineWithPrivateStateHandlers) WithCallbackRejectionAlert(alert TextBuilder) *EngineWithPrivateStateHandlers {
+	e.setCallbackRejectionAlert(alert)
+
+	return e
+}
+
+// CommandNames returns the names of the global commands and the commands of the static menus with static names.
+func (e *EngineWithPrivateStateHandlers) CommandNames() []string {
+	return e.commandNames()
+}
 
-	return e.AddStaticMenu(cfg.changeLanguageState, menu)
+// WithLanguageConfig adds a language config to the engine
+func (e *EngineWithPrivateStateHandlers) WithLanguageConfig(cfg *LanguageConfig) *EngineWithPrivateStateHandlers {
+	e.withLanguageConfig(cfg)
+
+	return e
 }
 
 func (e *EngineWithPrivateStateHandlers) Process(client *tgbotapi.TelegramBot, update tgbotapi.Update) {
-	if e.panicHandler != nil {
-		defer func() {
-			if r := recover(); r != nil {
-				e.panicHandler(client, update, r, string(debug.Stack()))
-			}
-		}()
-	}
+	e.ProcessContext(context.Background(), client, update)
+}
 
-	userState, err := e.processUserState(update)
-	if err != nil {
-		e.onErr(client, update, err)
-		return
-	}
+// ProcessContext processes the update with ctx exposed on the StateUpdate.
+func (e *EngineWithPrivateStateHandlers) ProcessContext(
+	ctx context.Context, client *tgbotapi.TelegramBot, update tgbotapi.Update) {
 
-	su := &StateUpdate{
-		storage:    &sync.Map{},
-		State:      userState,
-		Update:     update,
-		IsSwitched: false,
-	}
+	defer e.recoverPanic(client, update)
 
 	from := update.From()
 
@@ -208,64 +223,22 @@ func (e *EngineWithPrivateStateHandlers) Process(client *tgbotapi.TelegramBot, u
 		return
 	}
 
-	var lang *Language
+	su := e.newStateUpdate(ctx, update, from.Id, from.Id)
 
-	if e.languageConfig != nil {
-		userLanguage, err := e.languageConfig.repo.GetUserLanguage(from.Id)
+	if repo, ok := e.userRepository.(userModelRepository); ok {
+		user, err := repo.upsertUserModel(ctx, from)
 		if err != nil {
-			if e.languageConfig.forceChooseLanguage {
-				if update.CallbackQuery != nil {
-					go func() {
-						_, err := client.Send(client.AnswerCallbackQuery().
-							SetCallbackQueryId(update.CallbackQuery.Id).
-							SetShowAlert(false))
-						if err != nil {
-							e.onErr(client, update, err)
-						}
-					}()
-				}
-				if userState != e.languageConfig.changeLanguageState {
-					err = e.switchState(
-						from.Id, e.languageConfig.changeLanguageState, client, su)
-					if err != nil {
-						e.onErr(client, update, err)
-					}
-					return
-				}
-			} else {
-				e.onErr(client, update, err)
-				return
-			}
-		}
-
-		lang = e.languageConfig.languages.GetByTag(userLanguage)
-	}
-
-	su.language = lang
-
-	for _, f := range e.middlewares {
-		switchAction, pass := f.Handle(client, su)
-		if err := e.processSwitchAction(switchAction, su, client); err != nil {
-			e.onErr(client, update, err)
+			e.onErr(client, update, fmt.Errorf("cant_store_user: %s", err))
 			return
 		}
 
-		if !pass {
-			return
-		}
-	}
-
-	if update.Message != nil {
-		if handler := e.staticMenus[userState]; handler != nil {
-			e.processStaticHandler(from.Id, handler, client, su)
-			return
-		}
-	}
-
-	if update.CallbackQuery != nil {
-		e.processCallbackQuery(client, su)
+		su.user = user
+	} else if err := e.userRepository.UpsertUserContext(ctx, from); err != nil {
+		e.onErr(client, update, fmt.Errorf("cant_store_user: %s", err))
 		return
 	}
+
+	e.process(client, su)
 }
 
 // AddCallbackQueryHandler adds a callback query Handler
@@ -274,10 +247,7 @@ func (e *EngineWithPrivateStateHandlers) AddCallbackQueryHandler(
 	fn func(*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error),
 ) *EngineWithPrivateStateHandlers {
 
-	e.m.Lock()
-	defer e.m.Unlock()
-
-	e.callbackQueryHandlers[data] = fn
+	e.addCallbackQueryHandler(data, fn)
 
 	return e
 }
@@ -285,23 +255,18 @@ func (e *EngineWithPrivateStateHandlers) AddCallbackQueryHandler(
 func (e *EngineWithPrivateStateHandlers) SwitchState(
 	userID int64, client *tgbotapi.TelegramBot, update *StateUpdate, state string) error {
 
-	return e.switchState(userID, state, client, update)
+	update.chatID, update.userID = userID, userID
+
+	return e.switchState(state, client, update)
 }
 
+// SwitchUserState switches the state of the user outside of an update, running the transition hooks of the states.
+// It waits for the update of the user being processed, so a handler of the same user should return a SwitchAction
+// instead, calling it from there deadlocks.
 func (e *EngineWithPrivateStateHandlers) SwitchUserState(
 	client *tgbotapi.TelegramBot, userID int64, state string) error {
 
-	lang, err := e.userLanguage(userID)
-	if err != nil {
-		return err
-	}
-
-	return e.switchState(userID, state, client, &StateUpdate{
-		storage:    &sync.Map{},
-		State:      state,
-		language:   lang,
-		IsSwitched: true,
-	})
+	return e.switchStateOf(context.Background(), client, userID, userID, state)
 }
 
 func (e *EngineWithPrivateStateHandlers) SendInlineMenu(
@@ -310,21 +275,8 @@ func (e *EngineWithPrivateStateHandlers) SendInlineMenu(
 	return e.processInlineHandler(menu, client, update, shouldEdit)
 }
 
-// getCallbackQueryHandler returns a callback query Handler by data
-func (e *EngineWithPrivateStateHandlers) getCallbackQueryHandler(
-	data string) func(*tgbotapi.TelegramBot, *StateUpdate, ...string) (SwitchAction, error) {
-
-	e.m.Lock()
-	defer e.m.Unlock()
-
-	if handler, ok := e.callbackQueryHandlers[data]; ok {
-		return handler
-	}
-
-	return nil
-}
-
-func (e *EngineWithPrivateStateHandlers) canProcess(update tgbotapi.Update) bool {
+// CanProcess reports whether the update belongs to the engine.
+func (e *EngineWithPrivateStateHandlers) CanProcess(update tgbotapi.Update) bool {
 	if chat := update.Chat(); chat != nil && chat.Type == "private" {
 		return true
 	}
@@ -332,411 +284,19 @@ func (e *EngineWithPrivateStateHandlers) canProcess(update tgbotapi.Update) bool
 	return false
 }
 
-func (e *EngineWithPrivateStateHandlers) processCallbackQuery(
-	client *tgbotapi.TelegramBot,
-	update *StateUpdate,
-) {
-
-	if update.Update.CallbackQuery.Data == "" {
-		return
-	}
-
-	data := strings.Split(update.Update.CallbackQuery.Data, ":")
-
-	menu := data[0]
-
-	if inlineMenu, ok := e.inlineMenus[menu]; !ok {
-		if callbackHandler := e.getCallbackQueryHandler(data[0]); callbackHandler != nil {
-			switchAction, err := callbackHandler(client, update, data[1:]...)
-			if err != nil {
-				e.onErr(client, update.Update, err)
-				return
-			}
-
-			if err := e.processSwitchAction(switchAction, update, client); err != nil {
-				e.onErr(client, update.Update, err)
-			}
-		} else {
-			e.onErr(client, update.Update, errors.New("callback query Handler not found: "+data[0]))
-		}
-		return
-	} else {
-		if err := e.processInlineCallbackHandler(client, update, inlineMenu, data[1:]); err != nil {
-			e.onErr(client, update.Update, errors.New("error processing inline menu: "+err.Error()))
-		}
-
-		return
-	}
+// privateStateStore keeps the state of private chats in a UserRepository.
+type privateStateStore struct {
+	repo ContextUserRepository
 }
 
-func (e *EngineWithPrivateStateHandlers) processStaticHandler(
-	userID int64,
-	handler *StaticMenu,
-	client *tgbotapi.TelegramBot,
-	update *StateUpdate,
-) {
-
-	for _, middleware := range handler.middlewares {
-		if middleware.UpdateHandler == nil {
-			continue
-		}
-
-		switchAction, pass := middleware.Handle(client, update)
-
-		if err := e.processSwitchAction(switchAction, update, client); err != nil {
-			e.onErr(client, update.Update, err)
-			return
-		}
-
-		if !pass {
-			return
-		}
-	}
-
-	actionBuilder := handler.processActionBuilder(update)
-
-	if !update.IsSwitched {
-		if update.Update.Message != nil && update.Update.Message.Text != "" {
-			buttonText := update.Update.Message.Text
-
-			if actionBuilder != nil {
-				if buttonAction := actionBuilder.getButtonByButton(
-					update,
-					buttonText,
-				); buttonAction != nil {
-					var err error
-
-					shouldStop := true
-
-					switch a := buttonAction.(type) {
-					case textButton:
-						if _, err = client.
-							Send(client.Message().SetText(a.text.String(update)).SetChatId(userID)); err != nil {
-							err = fmt.Errorf("error_sending_message_to_user: %d, %w", userID, err)
-						}
-					case stateButton:
-						if a.hook != nil {
-							switchAction, pass := a.hook.Handle(client, update)
-							if err = e.processSwitchAction(switchAction, update, client); err != nil {
-								e.onErr(client, update.Update, err)
-								return
-							}
-
-							if !pass {
-								return
-							}
-						}
-
-						if err = e.switchState(userID, a.state, client, update); err != nil {
-							err = fmt.Errorf("error_switching_state: %d, %w", userID, err)
-						}
-					case inlineMenuButton:
-						err = e.processInlineHandler(a.inlineMenu, client, update, false)
-						if err != nil {
-							err = fmt.Errorf("error_switching_inline_menu: %d, %w", userID, err)
-						}
-					case rawButton:
-						shouldStop = false
-						// do nothing for raw action, as it is only used to act like a button and may be handled in a
-						// dynamic Handler
-						break
-					default:
-						err = fmt.Errorf("unknown_action_kind: %+v", buttonAction)
-					}
-
-					if err != nil {
-						e.onErr(client, update.Update, err)
-						return
-					}
-
-					if shouldStop {
-						return
-					}
-				}
-			}
-
-			if handler.dynamicHandlers != nil && handler.dynamicHandlers[TextHandler] != nil {
-				switchAction, pass := handler.dynamicHandlers[TextHandler].Handle(client, update)
-				if err := e.processSwitchAction(switchAction, update, client); err != nil {
-					e.onErr(client, update.Update, err)
-					return
-				}
-
-				if !pass {
-					return
-				}
-			}
-		}
-
-		if handler.dynamicHandlers != nil {
-			handlerName := ""
-
-			if update.Update.Message.Video != nil {
-				handlerName = VideoHandler
-			} else if update.Update.Message.Photo != nil {
-				handlerName = PhotoHandler
-			} else if update.Update.Message.Document != nil {
-				handlerName = DocumentHandler
-			} else if update.Update.Message.Voice != nil {
-				handlerName = VoiceHandler
-			} else if update.Update.Message.Audio != nil {
-				handlerName = AudioHandler
-			} else if update.Update.Message.Sticker != nil {
-				handlerName = StickerHandler
-			} else if update.Update.Message.Location != nil {
-				handlerName = LocationHandler
-			} else if update.Update.Message.Contact != nil {
-				handlerName = ContactHandler
-			} else if update.Update.Message.VideoNote != nil {
-				handlerName = VideoNoteHandler
-			}
-
-			var targetHandler = handler.dynamicHandlers[DefaultHandler]
-
-			if handlerName != "" {
-				if availableHandler := handler.dynamicHandlers[handlerName]; availableHandler != nil {
-					targetHandler = availableHandler
-				}
-			}
-
-			if targetHandler != nil {
-				switchAction, pass := targetHandler.Handle(client, update)
-
-				if err := e.processSwitchAction(switchAction, update, client); err != nil {
-					e.onErr(client, update.Update, err)
-					return
-				}
-
-				if !pass {
-					return
-				}
-			}
-		}
-	}
-
-	var replyMarkup *structs.ReplyKeyboardMarkup
-
-	if actionBuilder != nil {
-		lang := update.Language()
-
-		replyMarkup = actionBuilder.buildButtons(
-			update,
-			lang != nil && lang.rtl && e.languageConfig != nil && e.languageConfig.reverseButtonOrderInRowForRTL,
-		)
-	}
-
-	if replyText := handler.processReplyText(update); replyText != "" {
-		_, err := client.Send(client.Message().
-			SetText(replyText).
-			SetChatId(userID).
-			SetReplyMarkup(replyMarkup))
-		if err != nil {
-			e.onErr(client, update.Update,
-				fmt.Errorf("error_sending_message_to_user: %d, %w", userID, err))
-			return
-		}
-	}
+func (s privateStateStore) getState(update *StateUpdate) (string, error) {
+	return s.repo.GetUserStateContext(update.Context(), update.userID)
 }
 
-func (e *EngineWithPrivateStateHandlers) processInlineHandler(
-	menuName string, client *tgbotapi.TelegramBot, update *StateUpdate, edit bool) error {
-
-	menu, ok := e.inlineMenus[menuName]
-	if !ok {
-		return fmt.Errorf("inline_menu_not_found: %s", menuName)
-	}
-
-	from := update.Update.From()
-
-	if middlewares := menu.getMiddlewares(); len(middlewares) > 0 {
-		for _, middleware := range middlewares {
-			switchAction, pass := middleware.Handle(client, update)
-			if err := e.processSwitchAction(switchAction, update, client); err != nil {
-				return err
-			}
-
-			if !pass {
-				return nil
-			}
-		}
-	}
-
-	actionBuilder := menu.processActionBuilder(update)
-	if actionBuilder == nil {
-		return fmt.Errorf("inline_menu_action_builder_not_set: %s", menuName)
-	}
-
-	markup := actionBuilder.buildButtons(
-		update,
-		update.Language().rtl && e.languageConfig != nil && e.languageConfig.reverseButtonOrderInRowForRTL,
-	)
-
-	replyText := menu.processTextBuilder(update)
-	if replyText == "" {
-		return fmt.Errorf("inline_menu_reply_text_not_set: %s", menuName)
-	}
-
-	var cfg tgbotapi.Config
-
-	if edit {
-		cfg = client.EditMessageText().SetText(replyText).
-			SetChatId(from.Id).
-			SetMessageId(update.Update.CallbackQuery.Message.MessageId).
-			SetReplyMarkup(markup)
-	} else {
-		cfg = client.Message().
-			SetText(replyText).
-			SetChatId(from.Id).
-			SetReplyMarkup(markup)
-	}
-
-	_, err := client.Send(cfg)
-	if err != nil {
-		return fmt.Errorf("error_sending_message_to_user: %d, %w", from.Id, err)
-	}
-
-	return nil
-}
-
-func (e *EngineWithPrivateStateHandlers) switchState(
-	userID int64, nextState string, client *tgbotapi.TelegramBot, stateUpdate *StateUpdate) error {
-
-	if handler := e.staticMenus[nextState]; handler != nil {
-		if err := e.userRepository.SetUserState(userID, nextState); err != nil {
-			return fmt.Errorf("error_setting_user_state: %d, %w", userID, err)
-		}
-
-		stateUpdate.State = nextState
-		stateUpdate.IsSwitched = true
-
-		e.processStaticHandler(userID, handler, client, stateUpdate)
-
-		return nil
-	}
-
-	return fmt.Errorf("no_handler_for_state: %s", nextState)
-}
-
-func (e *EngineWithPrivateStateHandlers) processUserState(update tgbotapi.Update) (string, error) {
-	from := update.From()
-
-	if from == nil {
-		return "", errors.New("empty_from")
-	}
-
-	err := e.userRepository.UpsertUser(from)
-	if err != nil {
-		return "", fmt.Errorf("cant_store_user: %s", err)
-	}
-
-	if e.defaultStateName == "" {
-		return "", fmt.Errorf("empty_default_state_name")
-	}
-
-	userState, err := e.userRepository.GetUserState(from.Id)
-	if err != nil || userState == "" {
-		userState = e.defaultStateName
-		err = e.userRepository.SetUserState(from.Id, userState)
-		if err != nil {
-			return "", fmt.Errorf("store_user_state: %w", err)
-		}
-	}
-
-	return userState, nil
+func (s privateStateStore) key(update *StateUpdate) (int64, int64) {
+	return update.chatID, update.userID
 }
 
-func (e *EngineWithPrivateStateHandlers) userLanguage(userID int64) (*Language, error) {
-	var lang *Language
-
-	if e.languageConfig != nil {
-		userLanguage, _ := e.languageConfig.repo.GetUserLanguage(userID)
-		if userLanguage != "" {
-			lang = e.languageConfig.languages.GetByTag(userLanguage)
-		}
-	}
-
-	return lang, nil
-
-}
-
-// getHandlerByAction returns inline menu by action
-func (e *EngineWithPrivateStateHandlers) processInlineCallbackHandler(
-	client *tgbotapi.TelegramBot, update *StateUpdate, menu *InlineMenu, data []string) error {
-
-	if middlewares := menu.getMiddlewares(); len(middlewares) > 0 {
-		for _, middleware := range middlewares {
-			switchAction, pass := middleware.Handle(client, update)
-			if err := e.processSwitchAction(switchAction, update, client); err != nil {
-				return err
-			}
-
-			if !pass {
-				return nil
-			}
-		}
-	}
-
-	menuActionBuilder := menu.processActionBuilder(update)
-	if menuActionBuilder == nil {
-		return fmt.Errorf("inline_menu_action_builder_not_set: %s", menu.callbackPrefix)
-	}
-
-	actionHandlers := menuActionBuilder.getByCallbackActionData(update)
-	if actionHandlers == nil {
-		return fmt.Errorf("inline_menu_action_data_not_found: %s", menu.callbackPrefix)
-	}
-
-	if handler, ok := actionHandlers[data[0]]; !ok {
-		return fmt.Errorf("handler_for_action_not_found: %s", data[0])
-	} else {
-		switch btn := handler.(type) {
-		case inlineAlertButton:
-			cfg := client.AnswerCallbackQuery().
-				SetCallbackQueryId(update.Update.CallbackQuery.Id).
-				SetText(btn.text).
-				SetShowAlert(btn.showAlert)
-			_, err := client.Send(cfg)
-
-			return err
-		case inlineStateButton:
-			// TODO: Implement Switch With edit Message
-
-			return e.switchState(update.Update.From().Id, btn.state, client, update)
-		case inlineInlineMenuButton:
-			return e.processInlineHandler(btn.menu, client, update, btn.edit)
-		case inlineCallbackButton:
-			if btn.handler != nil {
-				switchAction, err := btn.handler(client, update, data[1:]...)
-				if err != nil {
-					return err
-				}
-
-				return e.processSwitchAction(switchAction, update, client)
-			}
-
-			return errors.New("callback query Handler not found")
-		}
-	}
-
-	return errors.New("processor_for_action_not_found")
-}
-
-func (e *EngineWithPrivateStateHandlers) processSwitchAction(
-	action SwitchAction,
-	update *StateUpdate,
-	client *tgbotapi.TelegramBot,
-) error {
-
-	if action == nil {
-		return nil
-	}
-
-	switch sa := action.(type) {
-	case *SwitchActionState:
-		return e.switchState(update.Update.From().Id, action.target(), client, update)
-	case *SwitchActionInlineMenu:
-		return e.processInlineHandler(action.target(), client, update, sa.edit)
-	}
-
-	return errors.New("unknown switch action")
+func (s privateStateStore) setState(update *StateUpdate, state string) error {
+	return s.repo.SetUserStateContext(update.Context(), update.userID, state)
 }
@@ -0,0 +1,108 @@
+package telejoon_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aliforever/go-telegram-bot-api"
+	"github.com/aliforever/go-telegram-bot-api/structs"
+	"github.com/aliforever/go-telejoon"
+)
+
+// privateTextUpdate returns a text message of user 1 in their private chat.
+func privateTextUpdate(text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &structs.Message{
+		MessageId: 1,
+		From:      &structs.User{Id: 1},
+		Chat:      &structs.Chat{Id: 1, Type: "private"},
+		Text:      text,
+	}}
+}
+
+func TestGlobalCommands(t *testing.T) {
+	var handled []string
+
+	record := func(name string, pass telejoon.ShouldPass) telejoon.UpdateHandler {
+		return func(client *tgbotapi.TelegramBot, update *telejoon.StateUpdate) (
+			telejoon.SwitchAction, telejoon.ShouldPass) {
+
+			handled = append(handled, name)
+
+			return nil, pass
+		}
+	}
+
+	tests := []struct {
+		name     string
+		state    string
+		text     string
+		expected []string
+		newState string
+	}{
+		{
+			name:     "global command before the static menu",
+			text:     "/help",
+			expected: []string{"middleware", "global help"},
+			newState: "Home",
+		},
+		{
+			name:     "global command passing to the static menu",
+			text:     "/settings",
+			expected: []string{"middleware", "global settings"},
+			newState: "Settings",
+		},
+		{
+			name:     "global state command in any state",
+			state:    "Settings",
+			text:     "/home",
+			expected: []string{"middleware"},
+			newState: "Home",
+		},
+		{
+			name:     "static menu command",
+			text:     "/about",
+			expected: []string{"middleware"},
+			newState: "About",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+
+			repo := telejoon.NewDefaultUserRepository()
+
+			// the menus have no text, so nothing is sent to the chat
+			engine := telejoon.WithPrivateStateHandlers(repo, "Home").
+				AddMiddleware(record("middleware", true)).
+				AddGlobalCommand("/help", record("global help", false)).
+				AddGlobalCommand("settings", record("global settings", true)).
+				AddGlobalStateCommand("/home", "Home").
+				AddStaticMenu("Home", telejoon.NewStaticMenu(
+					telejoon.NewStaticText(""),
+					telejoon.NewStaticActionBuilder().
+						AddStateCommand(telejoon.NewStaticText("/help"), "Help").
+						AddStateCommand(telejoon.NewStaticText("/settings"), "Settings").
+						AddStateCommand(telejoon.NewStaticText("/about"), "About"))).
+				AddStaticMenu("Help", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+				AddStaticMenu("Settings", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil)).
+				AddStaticMenu("About", telejoon.NewStaticMenu(telejoon.NewStaticText(""), nil))
+
+			if tt.state != "" {
+				if err := engine.SwitchUserState(nil, 1, tt.state); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			engine.Process(nil, privateTextUpdate(tt.text))
+
+			if !reflect.DeepEqual(handled, tt.expected) {
+				t.Fatalf("expected %v to be handled, got %v", tt.expected, handled)
+			}
+
+			if state, _ := repo.GetUserState(1); state != tt.newState {
+				t.Fatalf("expected the state %s, got %s", tt.newState, state)
+			}
+		})
+	}
+}